@@ -0,0 +1,268 @@
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	clientSourceConfig   = "config"
+	clientSourceDatabase = "database"
+)
+
+// adminClientRequest is client registered by administrator, secret is generated for confidential client when not set
+type adminClientRequest struct {
+	utils.Client
+	ClientSecret string `json:"client_secret,omitempty"`
+	Public       bool   `json:"public"`
+}
+
+// adminClientResponse never contains secret hash, generated secret is returned only once
+type adminClientResponse struct {
+	utils.Client
+	ClientSecret string `json:"client_secret,omitempty"`
+	Public       bool   `json:"public"`
+	Source       string `json:"source"`
+}
+
+func newAdminClientResponse(client utils.Client, source string) *adminClientResponse {
+	response := &adminClientResponse{Client: client, Public: oauthserver.IsPublicClient(&client), Source: source}
+	response.ClientSecretHash = ""
+	return response
+}
+
+// adminAuth protects admin API with bearer token from configuration, API is disabled without the token
+func adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _cfg.Server.AdminToken == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(_cfg.Server.AdminToken)) != 1 {
+			log.Warn("Unauthorized access to admin API: ", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJson(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func adminListClients(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (GET): /admin/v1/clients")
+	static, registered, err := oauthserver.ListClients()
+	if err != nil {
+		log.Error("Unable to list clients: ", err)
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	response := []*adminClientResponse{}
+	for _, v := range static {
+		response = append(response, newAdminClientResponse(v, clientSourceConfig))
+	}
+	for _, v := range registered {
+		response = append(response, newAdminClientResponse(v, clientSourceDatabase))
+	}
+	writeJson(w, http.StatusOK, response)
+}
+
+func adminGetClient(w http.ResponseWriter, r *http.Request) {
+	clientId := mux.Vars(r)["client_id"]
+	log.Debug("Endpoint Hit (GET): /admin/v1/clients/" + clientId)
+	client := oauthserver.FindRegisteredClient(clientId)
+	if client == nil {
+		writeJson(w, http.StatusNotFound, map[string]string{"error": oauthserver.ErrClientNotFound.Error()})
+		return
+	}
+	writeJson(w, http.StatusOK, newAdminClientResponse(*client, adminClientSource(clientId)))
+}
+
+func adminPutClient(w http.ResponseWriter, r *http.Request) {
+	clientId := mux.Vars(r)["client_id"]
+	log.Debug("Endpoint Hit (PUT): /admin/v1/clients/" + clientId)
+	request := &adminClientRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	client := request.Client
+	client.ClientId = clientId
+	client.ClientSecretHash = ""
+
+	// client waiting for approval is approved by approve endpoint only
+	existing := oauthserver.FindRegisteredClient(clientId)
+	client.Pending = existing != nil && existing.Pending
+
+	secret := request.ClientSecret
+	if !request.Public {
+		if secret == "" && existing != nil && existing.ClientSecretHash != "" {
+			client.ClientSecretHash = existing.ClientSecretHash
+		} else {
+			if secret == "" {
+				secret = utils.GenerateRandomString(48)
+			}
+			hash, err := oauthserver.HashClientSecret(secret)
+			if err != nil {
+				log.Error("Unable to hash client secret: ", err)
+				writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+				return
+			}
+			client.ClientSecretHash = hash
+		}
+	}
+	for _, v := range client.Providers {
+		if _, ok := oauthclient.GetProvider(v); !ok {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "unknown provider " + v})
+			return
+		}
+	}
+
+	if err := oauthserver.SaveClient(&client); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, oauthserver.ErrStaticClient) {
+			status = http.StatusConflict
+		} else if errors.Is(err, oauthserver.ErrInvalidMetadata) {
+			status = http.StatusBadRequest
+		} else {
+			log.Error("Unable to save client: ", err)
+		}
+		writeJson(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	log.WithFields(log.Fields{
+		"clientId": clientId,
+	}).Info("OAuth client saved")
+
+	response := newAdminClientResponse(client, clientSourceDatabase)
+	if secret != request.ClientSecret {
+		response.ClientSecret = secret
+	}
+	writeJson(w, http.StatusOK, response)
+}
+
+func adminDeleteClient(w http.ResponseWriter, r *http.Request) {
+	clientId := mux.Vars(r)["client_id"]
+	log.Debug("Endpoint Hit (DELETE): /admin/v1/clients/" + clientId)
+	if err := oauthserver.DeleteClient(clientId); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, oauthserver.ErrStaticClient) {
+			status = http.StatusConflict
+		} else if errors.Is(err, oauthserver.ErrClientNotFound) {
+			status = http.StatusNotFound
+		} else {
+			log.Error("Unable to delete client: ", err)
+		}
+		writeJson(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	log.WithFields(log.Fields{
+		"clientId": clientId,
+	}).Info("OAuth client deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminApproveClient allows dynamically registered client to be used
+func adminApproveClient(w http.ResponseWriter, r *http.Request) {
+	clientId := mux.Vars(r)["client_id"]
+	log.Debug("Endpoint Hit (POST): /admin/v1/clients/" + clientId + "/approve")
+	if err := oauthserver.ApproveClient(clientId); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, oauthserver.ErrStaticClient) {
+			status = http.StatusConflict
+		} else if errors.Is(err, oauthserver.ErrClientNotFound) {
+			status = http.StatusNotFound
+		} else {
+			log.Error("Unable to approve client: ", err)
+		}
+		writeJson(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	log.WithFields(log.Fields{
+		"clientId": clientId,
+	}).Info("OAuth client approved")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminRevokeToken revokes any token issued by the server
+func adminRevokeToken(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /admin/v1/revoke")
+	if err := r.ParseForm(); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	revoked, err := oauthserver.RevokeAnyToken(r.PostForm.Get("token"))
+	if err != nil {
+		log.Error("Unable to revoke token: ", err)
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	if !revoked {
+		writeJson(w, http.StatusNotFound, map[string]string{"error": "token is not valid"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminRevokeUser revokes all outstanding tokens of the user
+func adminRevokeUser(w http.ResponseWriter, r *http.Request) {
+	upn := mux.Vars(r)["upn"]
+	log.Debug("Endpoint Hit (POST): /admin/v1/users/" + upn + "/revoke")
+	if err := oauthserver.RevokeUserTokens(upn); err != nil {
+		log.Error("Unable to revoke tokens of user: ", err)
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminListKeys lists signing keys of the key set with their rotation status
+func adminListKeys(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (GET): /admin/v1/keys")
+	keys := oauthserver.SigningKeys()
+	if keys == nil {
+		keys = []oauthserver.KeyInfo{}
+	}
+	writeJson(w, http.StatusOK, keys)
+}
+
+// adminListBackchannelLogouts returns delivery log of back-channel logouts, optionally of one client
+func adminListBackchannelLogouts(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (GET): /admin/v1/backchannel_logouts")
+	deliveries, err := oauthserver.ListBackchannelLogouts(r.URL.Query().Get("client_id"))
+	if err != nil {
+		log.Error("Unable to list back-channel logouts: ", err)
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJson(w, http.StatusOK, deliveries)
+}
+
+// adminActivateKey promotes signing key of the key set to active key immediately
+func adminActivateKey(w http.ResponseWriter, r *http.Request) {
+	kid := mux.Vars(r)["kid"]
+	log.Debug("Endpoint Hit (POST): /admin/v1/keys/" + kid + "/activate")
+	if err := oauthserver.PromoteSigningKey(kid); err != nil {
+		if errors.Is(err, oauthserver.ErrUnknownKey) {
+			writeJson(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		log.Error("Unable to activate signing key: ", err)
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJson(w, http.StatusOK, oauthserver.SigningKeys())
+}
+
+func adminClientSource(clientId string) string {
+	if oauthserver.IsStaticClient(clientId) {
+		return clientSourceConfig
+	}
+	return clientSourceDatabase
+}
@@ -12,13 +12,13 @@ import (
 	nebulaAuthHandler "github.com/shieldoo/shieldoo-mesh-oauth/handler"
 	"github.com/shieldoo/shieldoo-mesh-oauth/model"
 	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient/basicauth"
 	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
 	log "github.com/sirupsen/logrus"
 )
 
 var codeValidRegex = regexp.MustCompile("^[a-zA-Z0-9-_:]{32,72}$")
 var audienceValidRegex = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9-]{2,63}$")
-var providerValidRegex = regexp.MustCompile("^(microsoft|google)$")
 var _cfg *utils.Config
 
 func validateRegex(regex *regexp.Regexp, value string) (bool, error) {
@@ -31,15 +31,45 @@ func validateRegex(regex *regexp.Regexp, value string) (bool, error) {
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("Endpoint Hit (GET): / ")
-	code := r.URL.Query().Get("state")
-	if _, err := validateRegex(codeValidRegex, code); err != nil {
-		code = ""
+	query := r.URL.Query()
+	params := &model.Params{
+		Code:     query.Get("state"),
+		Audience: query.Get("audience"),
+		Redirect: query.Get("redirect"),
+		Tenant:   query.Get("aad_tenant_id"),
+		ClientId: query.Get("client_id"),
+		Jkt:      query.Get("dpop_jkt"),
 	}
-	redirect := r.URL.Query().Get("redirect")
-	audience := r.URL.Query().Get("audience")
-	tenant := r.URL.Query().Get("aad_tenant_id")
-	if audience == "" && code != "" {
+	if requestUri := query.Get("request_uri"); requestUri != "" {
+		var err error
+		if params, err = pushedLogin(params.ClientId, requestUri, false); err != nil {
+			utils.GeneralResponseTemplate(w, "Login request has expired, please try it again.", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, err := validateRegex(codeValidRegex, params.Code); err != nil {
+		params.Code = ""
+	}
+	if params.Audience == "" && params.Code != "" {
 		utils.GeneralResponseTemplate(w, "Missing audience parameter when device login active.", http.StatusBadRequest)
+		return
+	}
+	if !isValidJkt(params.Jkt) {
+		utils.GeneralResponseTemplate(w, "Invalid dpop_jkt parameter", http.StatusBadRequest)
+		return
+	}
+	client, audience, err := loginClient(params.ClientId, params.Audience)
+	if err != nil {
+		utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if params.RequestUri == "" && oauthserver.IsPushedRequestRequired(client) {
+		utils.GeneralResponseTemplate(w, "Pushed authorization request is required for the client", http.StatusBadRequest)
+		return
+	}
+	if params.Jkt == "" && oauthserver.IsDPoPRequired(client) {
+		utils.GeneralResponseTemplate(w, "dpop_jkt parameter is required for the client", http.StatusBadRequest)
+		return
 	}
 	if audience == "" {
 		audience = _cfg.OAuthServer.DefaultAudience
@@ -48,10 +78,55 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		utils.GeneralResponseTemplate(w, "Missing or invalid audience parameter", http.StatusBadRequest)
 		return
 	}
-	if _cfg.BasicAuth.Enabled {
-		utils.RenderTemplate(w, "basicauth", &model.Params{Code: code, Audience: audience, Redirect: redirect})
+	params.Audience = audience
+	if params.Code != "" {
+		renderDeviceLoginConfirmation(w, r, params, client)
+		return
+	}
+	renderLogin(w, params, client)
+}
+
+// loginClient finds client of login page, audience of such login is given by the client
+func loginClient(clientId string, audience string) (*utils.Client, string, error) {
+	if clientId == "" {
+		if _cfg.OAuthServer.RequireClient {
+			return nil, "", errors.New("Missing client_id parameter")
+		}
+		return nil, audience, nil
+	}
+	client := oauthserver.FindClient(clientId)
+	if client == nil {
+		return nil, "", errors.New("Unknown client_id parameter")
+	}
+	clientAudience := oauthserver.ClientAudience(client)
+	if audience != "" && audience != clientAudience {
+		return nil, "", errors.New("Audience is not allowed for the client")
+	}
+	return client, clientAudience, nil
+}
+
+// renderLogin shows providers allowed for the client, the provider is selected automatically when there is nothing to choose from
+func renderLogin(w http.ResponseWriter, params *model.Params, client *utils.Client) {
+	page := &model.LoginPage{Params: params}
+	for _, p := range oauthclient.Providers() {
+		if client == nil || oauthserver.IsProviderAllowed(client, p.Name()) {
+			page.Providers = append(page.Providers, model.LoginProvider{Name: p.Name(), DisplayName: p.DisplayName()})
+		}
+	}
+	if len(page.Providers) == 0 {
+		utils.GeneralResponseTemplate(w, "No identity provider is allowed for the client", http.StatusForbidden)
+		return
+	}
+	// basic auth takes over login page when enabled
+	if _, ok := oauthclient.GetProvider(basicauth.Name); ok && (client == nil || oauthserver.IsProviderAllowed(client, basicauth.Name)) {
+		page.Params.Provider = basicauth.Name
+	} else if len(page.Providers) == 1 {
+		page.Params.Provider = page.Providers[0].Name
+	}
+	if page.Params.Provider != "" {
+		utils.RenderTemplate(w, "autologin", page)
 	} else {
-		utils.RenderTemplate(w, "login", &model.Params{Code: code, Audience: audience, Redirect: redirect, Tenant: tenant})
+		utils.RenderTemplate(w, "login", page)
 	}
 }
 
@@ -69,31 +144,109 @@ func authorizeHandler(w http.ResponseWriter, r *http.Request) {
 	redirect := r.Form.Get("redirect")
 	audience := r.Form.Get("audience")
 	tenant := r.Form.Get("tenant")
+	request := r.Form.Get("request")
+	clientId := r.Form.Get("client_id")
+	userCode := r.Form.Get("user_code")
+	jkt := r.Form.Get("dpop_jkt")
+	var client *utils.Client
+	if userCode != "" {
+		// login of device confirmed by user, audience is given by the client
+		device, deviceClient, status, err := findDeviceClient(r, userCode)
+		if err != nil {
+			utils.GeneralResponseTemplate(w, err.Error(), status)
+			return
+		}
+		client = deviceClient
+		clientId = client.ClientId
+		audience = device.Audience
+		code = ""
+		redirect = ""
+		request = ""
+		jkt = ""
+	} else if request != "" {
+		// login of OAuth client, audience is given by the client
+		authRequest, err := oauthserver.GetAuthorizationRequest(request)
+		if err != nil {
+			utils.GeneralResponseTemplate(w, "Login request has expired, please try it again.", http.StatusBadRequest)
+			return
+		}
+		clientId = authRequest.ClientId
+		client = oauthserver.FindClient(clientId)
+		if client == nil {
+			utils.GeneralResponseTemplate(w, "Client is no longer registered", http.StatusBadRequest)
+			return
+		}
+		audience = authRequest.Audience
+		code = ""
+		redirect = ""
+		jkt = ""
+	} else if requestUri := r.Form.Get("request_uri"); requestUri != "" {
+		// login with parameters pushed by the client, parameters of the form are ignored
+		pushed, err := pushedLogin(clientId, requestUri, true)
+		if err != nil {
+			utils.GeneralResponseTemplate(w, "Login request has expired, please try it again.", http.StatusBadRequest)
+			return
+		}
+		code = pushed.Code
+		redirect = pushed.Redirect
+		tenant = pushed.Tenant
+		jkt = pushed.Jkt
+		if client, audience, err = loginClient(clientId, pushed.Audience); err != nil {
+			utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var err error
+		if client, audience, err = loginClient(clientId, audience); err != nil {
+			utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if oauthserver.IsPushedRequestRequired(client) {
+			utils.GeneralResponseTemplate(w, "Pushed authorization request is required for the client", http.StatusBadRequest)
+			return
+		}
+	}
 	if _, err := validateRegex(audienceValidRegex, audience); err != nil {
 		utils.GeneralResponseTemplate(w, "Missing or invalid audience parameter", http.StatusBadRequest)
 		return
 	}
+	if !isValidJkt(jkt) {
+		utils.GeneralResponseTemplate(w, "Invalid dpop_jkt parameter", http.StatusBadRequest)
+		return
+	}
+	// tokens of login page are handed out in URL fragment, they have to be bound to DPoP key of such client,
+	// tokens of OAuth and device flows are bound at token endpoint
+	if request == "" && userCode == "" && jkt == "" && oauthserver.IsDPoPRequired(client) {
+		utils.GeneralResponseTemplate(w, "dpop_jkt parameter is required for the client", http.StatusBadRequest)
+		return
+	}
+	if code != "" && !isDeviceLoginConfirmed(r, code) {
+		log.Warn("Device login was not confirmed by user")
+		utils.GeneralResponseTemplate(w, "Device login was not confirmed, please start login on your device again.", http.StatusForbidden)
+		return
+	}
 	provider := r.Form.Get("provider")
-	if _, err := validateRegex(providerValidRegex, provider); err != nil {
+	if _, ok := oauthclient.GetProvider(provider); !ok {
 		utils.GeneralResponseTemplate(w, "Missing or invalid provider parameter", http.StatusBadRequest)
 		return
 	}
+	if client != nil && !oauthserver.IsProviderAllowed(client, provider) {
+		log.Warn("Provider ", provider, " is not allowed for client ", clientId)
+		utils.GeneralResponseTemplate(w, "Provider is not allowed for the client", http.StatusForbidden)
+		return
+	}
 	params := &model.Params{
 		Code:     code,
 		Audience: audience,
 		Provider: provider,
 		Redirect: redirect,
 		Tenant:   tenant,
+		Request:  request,
+		ClientId: clientId,
+		UserCode: userCode,
+		Jkt:      jkt,
 	}
-	var url string
-	var err error
-	switch provider {
-	case "microsoft":
-		url, err = oauthclient.GetAuthorizeMicrosoftUrl(params)
-	case "google":
-		url, err = oauthclient.GetAuthorizeGoogleUrl(params)
-	}
-
+	url, err := oauthclient.GetAuthorizeUrl(w, provider, params)
 	if err != nil || url == "" {
 		log.Error(err)
 		utils.GeneralResponseTemplate(w, "Internal server error", http.StatusInternalServerError)
@@ -104,81 +257,11 @@ func authorizeHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, url, http.StatusFound)
 }
 
-// TODO: Refactor: Duplicity with google handler
-func callbackBasicauthHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug("Endpoint Hit (POST): /callback/basicauth")
-
-	if !_cfg.BasicAuth.Enabled {
-		utils.GeneralResponseTemplate(w, "Basic auth is not enabled.", http.StatusBadRequest)
-		return
-	}
-
-	// get username and password from basic auth
-	username, password, ok := r.BasicAuth()
-	if !ok {
-		log.Debug("Endpoint Hit (POST): /callback/basicauth with missing basic auth")
-		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// check if user exists in array of htaccess users
-	if !utils.CheckHtaccessUser(username, password) {
-		log.Debug("Endpoint Hit (POST): /callback/basicauth with invalid basic auth")
-		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	if err := r.ParseForm(); err != nil {
-		utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	code := r.Form.Get("code")
-	if _, err := validateRegex(codeValidRegex, code); err != nil {
-		log.Info("Invalid or missing code, code will be empty.")
-		code = ""
-	}
-	redirect := r.Form.Get("redirect")
-	audience := r.Form.Get("audience")
-	if _, err := validateRegex(audienceValidRegex, audience); err != nil {
-		utils.GeneralResponseTemplate(w, "Missing or invalid audience parameter", http.StatusBadRequest)
-		return
-	}
-	params := &model.Params{
-		Code:     code,
-		Audience: audience,
-		Provider: "basicauth",
-		Redirect: redirect,
-		Upn:      username,
-	}
-
-	userDetails, err := nebulaAuthHandler.HandleAuthorization(w, username, params)
-	if err == nil {
-		nebulaAuthHandler.HandleOauth(w, r, params, userDetails)
-	}
-}
-
-func callbackMicrosoftHandler(w http.ResponseWriter, request *http.Request) {
-	log.Debug("Endpoint Hit (POST): /callback/microsoft")
-
-	params, err := oauthclient.HandleMicrosoftCallback(request)
-
-	if err != nil {
-		http.Error(w, "Error when processing request.", http.StatusUnauthorized)
-		return
-	}
-
-	userDetails, err := nebulaAuthHandler.HandleAuthorization(w, params.Upn, params)
-	if err == nil {
-		nebulaAuthHandler.HandleOauth(w, request, params, userDetails)
-	}
-}
-
-func callbackGoogleHandler(w http.ResponseWriter, request *http.Request) {
-	log.Debug("Endpoint Hit (POST): /callback/google")
+func callbackHandler(w http.ResponseWriter, request *http.Request) {
+	provider := mux.Vars(request)["provider"]
+	log.Debug("Endpoint Hit: /callback/" + provider)
 
-	params, err := oauthclient.HandleGoogleCallback(request)
+	params, err := oauthclient.HandleCallback(provider, w, request)
 	if err != nil {
 		http.Error(w, "Error when processing request.", http.StatusUnauthorized)
 		return
@@ -218,11 +301,32 @@ func Run(cfg *utils.Config) {
 	myRouter := mux.NewRouter()
 	myRouter.HandleFunc("/", loginHandler).Methods("GET")
 	myRouter.HandleFunc("/authorize", authorizeHandler).Methods("POST")
-	myRouter.HandleFunc("/callback/microsoft", callbackMicrosoftHandler).Methods("POST")
-	myRouter.HandleFunc("/callback/google", callbackGoogleHandler).Methods("POST")
-	myRouter.HandleFunc("/callback/basicauth", callbackBasicauthHandler).Methods("POST")
+	myRouter.HandleFunc("/callback/{provider}", callbackHandler).Methods("GET", "POST")
 	myRouter.HandleFunc("/oauth2/v1/certs", oauthCerts).Methods("GET")
+	myRouter.HandleFunc("/oauth2/v1/authorize", oauthAuthorize).Methods("GET", "POST")
+	myRouter.HandleFunc("/oauth2/v1/par", oauthPushedAuthorizationRequest).Methods("POST")
+	myRouter.HandleFunc("/oauth2/v1/token", oauthToken).Methods("POST")
+	myRouter.HandleFunc("/oauth2/v1/introspect", oauthIntrospect).Methods("POST")
+	myRouter.HandleFunc("/oauth2/v1/revoke", oauthRevoke).Methods("POST")
+	myRouter.HandleFunc("/oauth2/v1/userinfo", oauthUserInfo).Methods("GET", "POST")
+	myRouter.HandleFunc("/oauth2/v1/register", oauthRegister).Methods("POST")
+	myRouter.HandleFunc("/oauth2/v1/register/{client_id}", oauthClientConfiguration).Methods("GET", "PUT", "DELETE")
+	myRouter.HandleFunc("/oauth2/v1/logout", oauthLogout).Methods("GET", "POST")
+	myRouter.HandleFunc("/oauth2/v1/device_authorization", oauthDeviceAuthorization).Methods("POST")
+	myRouter.HandleFunc("/device", deviceHandler).Methods("GET")
+	myRouter.HandleFunc("/device", deviceConfirmHandler).Methods("POST")
+	myRouter.HandleFunc("/device/login", deviceLoginHandler).Methods("POST")
 	myRouter.HandleFunc("/.well-known/openid-configuration", openIdConfiguration).Methods("GET")
+	myRouter.HandleFunc("/admin/v1/clients", adminAuth(adminListClients)).Methods("GET")
+	myRouter.HandleFunc("/admin/v1/clients/{client_id}", adminAuth(adminGetClient)).Methods("GET")
+	myRouter.HandleFunc("/admin/v1/clients/{client_id}", adminAuth(adminPutClient)).Methods("PUT")
+	myRouter.HandleFunc("/admin/v1/clients/{client_id}", adminAuth(adminDeleteClient)).Methods("DELETE")
+	myRouter.HandleFunc("/admin/v1/clients/{client_id}/approve", adminAuth(adminApproveClient)).Methods("POST")
+	myRouter.HandleFunc("/admin/v1/revoke", adminAuth(adminRevokeToken)).Methods("POST")
+	myRouter.HandleFunc("/admin/v1/users/{upn}/revoke", adminAuth(adminRevokeUser)).Methods("POST")
+	myRouter.HandleFunc("/admin/v1/keys", adminAuth(adminListKeys)).Methods("GET")
+	myRouter.HandleFunc("/admin/v1/keys/{kid}/activate", adminAuth(adminActivateKey)).Methods("POST")
+	myRouter.HandleFunc("/admin/v1/backchannel_logouts", adminAuth(adminListBackchannelLogouts)).Methods("GET")
 
 	log.Fatal(http.ListenAndServe(":"+cfg.Server.Port, myRouter))
 }
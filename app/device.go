@@ -0,0 +1,117 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// oauthDeviceAuthorization is OAuth 2.0 device authorization endpoint (RFC 8628 section 3.1)
+func oauthDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /oauth2/v1/device_authorization")
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthserver.ErrInvalidRequest(err.Error()))
+		return
+	}
+	client, err := oauthserver.AuthenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	if !oauthserver.IsGrantTypeAllowed(client, oauthserver.GrantTypeDeviceCode) {
+		writeOAuthError(w, oauthserver.ErrUnauthorizedClient("client is not allowed to use device code grant"))
+		return
+	}
+
+	response, err := oauthserver.CreateDeviceAuthorization(client, r.PostForm.Get("scope"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	log.WithFields(log.Fields{
+		"clientId": client.ClientId,
+	}).Info("Device authorization started")
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, http.StatusOK, response)
+}
+
+// deviceHandler shows user code entry page, known user code is shown with client asking for access
+func deviceHandler(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (GET): /device")
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		utils.RenderTemplate(w, "device", &model.DevicePage{})
+		return
+	}
+	device, client, status, err := findDeviceClient(r, userCode)
+	if err != nil {
+		utils.RenderTemplateWithResultCode(w, "device", &model.DevicePage{UserCode: userCode, Error: err.Error()}, status)
+		return
+	}
+	utils.RenderTemplate(w, "device", &model.DevicePage{UserCode: device.UserCode, ClientName: clientName(client)})
+}
+
+// deviceConfirmHandler lets user sign in for confirmed device or deny device authorization
+func deviceConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /device")
+	if err := r.ParseForm(); err != nil {
+		utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userCode := r.PostForm.Get("user_code")
+	device, client, status, err := findDeviceClient(r, userCode)
+	if err != nil {
+		utils.RenderTemplateWithResultCode(w, "device", &model.DevicePage{UserCode: userCode, Error: err.Error()}, status)
+		return
+	}
+	if r.PostForm.Get("action") == "deny" {
+		if err := oauthserver.DenyDeviceAuthorization(userCode); err != nil {
+			utils.GeneralResponseTemplate(w, "Device sign in request has expired.", http.StatusBadRequest)
+			return
+		}
+		utils.GeneralResponseTemplate(w, "Device sign in has been denied.", http.StatusOK)
+		return
+	}
+	renderLogin(w, &model.Params{Audience: device.Audience, ClientId: client.ClientId, UserCode: device.UserCode}, client)
+}
+
+// findDeviceClient returns device authorization of user code entered by user and its client, or error
+// shown to the user with status code
+func findDeviceClient(r *http.Request, userCode string) (*oauthserver.DeviceAuthorization, *utils.Client, int, error) {
+	device, err := oauthserver.FindDeviceAuthorization(userCode, clientIp(r))
+	if err != nil {
+		if errors.Is(err, oauthserver.ErrTooManyUserCodeFailures) {
+			return nil, nil, http.StatusTooManyRequests, errors.New("Too many invalid codes, please try it again later.")
+		}
+		if !errors.Is(err, oauthserver.ErrDeviceAuthorizationNotFound) {
+			log.Error("Unable to load device authorization: ", err)
+		}
+		return nil, nil, http.StatusBadRequest, errors.New("Invalid or expired code, please check the code shown on your device.")
+	}
+	client := oauthserver.FindClient(device.ClientId)
+	if client == nil {
+		return nil, nil, http.StatusBadRequest, errors.New("Client is no longer registered")
+	}
+	return device, client, http.StatusOK, nil
+}
+
+// clientIp is address of the browser connection
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func clientName(client *utils.Client) string {
+	if client.Name != "" {
+		return client.Name
+	}
+	return client.ClientId
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	deviceLoginCsrfCookieName = "shdoauth_device_csrf"
+	deviceLoginCookieName     = "shdoauth_device"
+
+	maxDeviceInfoLength = 64
+)
+
+// renderDeviceLoginConfirmation asks user to confirm device login started by Shieldoo client with state code,
+// user has to check that user code matches code shown on the device, so pre-filled login link sent
+// by attacker can not sign in attacker's device
+func renderDeviceLoginConfirmation(w http.ResponseWriter, r *http.Request, params *model.Params, client *utils.Client) {
+	csrf := utils.GenerateRandomString(32)
+	http.SetCookie(w, deviceLoginCookie(deviceLoginCsrfCookieName, csrf, 600))
+	page := &model.DevicePage{
+		UserCode:   oauthserver.DeviceLoginUserCode(params.Code),
+		ClientName: "Shieldoo client",
+		DeviceName: deviceInfo(r.URL.Query().Get("device_name")),
+		DeviceOs:   deviceInfo(r.URL.Query().Get("device_os")),
+		Params:     params,
+		Csrf:       csrf,
+	}
+	if client != nil {
+		page.ClientName = clientName(client)
+	}
+	utils.RenderTemplate(w, "device", page)
+}
+
+// deviceLoginHandler continues to login page when user confirmed device login, denied login is dropped
+func deviceLoginHandler(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /device/login")
+	if err := r.ParseForm(); err != nil {
+		utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cookie, err := r.Cookie(deviceLoginCsrfCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostForm.Get("csrf"))) != 1 {
+		log.Warn("Device login confirmation without matching cookie")
+		utils.GeneralResponseTemplate(w, "Device login confirmation has expired, please start login on your device again.", http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, deviceLoginCookie(deviceLoginCsrfCookieName, "", -1))
+
+	params := &model.Params{
+		Code:     r.PostForm.Get("code"),
+		Audience: r.PostForm.Get("audience"),
+		Redirect: r.PostForm.Get("redirect"),
+		Tenant:   r.PostForm.Get("tenant"),
+		ClientId: r.PostForm.Get("client_id"),
+		Jkt:      r.PostForm.Get("dpop_jkt"),
+	}
+	if requestUri := r.PostForm.Get("request_uri"); requestUri != "" {
+		if params, err = pushedLogin(params.ClientId, requestUri, false); err != nil {
+			utils.GeneralResponseTemplate(w, "Login request has expired, please try it again.", http.StatusBadRequest)
+			return
+		}
+	}
+	code := params.Code
+	if _, err := validateRegex(codeValidRegex, code); err != nil {
+		utils.GeneralResponseTemplate(w, "Missing or invalid device login code", http.StatusBadRequest)
+		return
+	}
+	client, audience, err := loginClient(params.ClientId, params.Audience)
+	if err != nil {
+		utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if params.RequestUri == "" && oauthserver.IsPushedRequestRequired(client) {
+		utils.GeneralResponseTemplate(w, "Pushed authorization request is required for the client", http.StatusBadRequest)
+		return
+	}
+	if _, err := validateRegex(audienceValidRegex, audience); err != nil {
+		utils.GeneralResponseTemplate(w, "Missing or invalid audience parameter", http.StatusBadRequest)
+		return
+	}
+	fields := log.Fields{
+		"audience":   audience,
+		"userCode":   oauthserver.DeviceLoginUserCode(code),
+		"deviceName": deviceInfo(r.PostForm.Get("device_name")),
+		"deviceOs":   deviceInfo(r.PostForm.Get("device_os")),
+	}
+	if r.PostForm.Get("action") != "approve" {
+		log.WithFields(fields).Warn("Device login denied by user")
+		utils.GeneralResponseTemplate(w, "Device sign in has been denied. Now you can close your browser.", http.StatusOK)
+		return
+	}
+
+	token, err := oauthserver.ConfirmDeviceLogin(code)
+	if err != nil {
+		log.Error("Unable to store device login confirmation: ", err)
+		utils.GeneralResponseTemplate(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.WithFields(fields).Info("Device login confirmed by user")
+	http.SetCookie(w, deviceLoginCookie(deviceLoginCookieName, token, 600))
+	params.Audience = audience
+	renderLogin(w, params, client)
+}
+
+// isDeviceLoginConfirmed checks that device login code was confirmed in this browser
+func isDeviceLoginConfirmed(r *http.Request, code string) bool {
+	cookie, err := r.Cookie(deviceLoginCookieName)
+	if err != nil {
+		return false
+	}
+	return oauthserver.IsDeviceLoginConfirmed(cookie.Value, code)
+}
+
+// deviceLoginCookie is sent only by same-site requests, so cross-site form can not confirm device login
+func deviceLoginCookie(name string, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(_cfg.Server.Uri, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// deviceInfo is device name or OS sent by client, it is shown to user only
+func deviceInfo(value string) string {
+	runes := []rune(strings.TrimSpace(value))
+	if len(runes) > maxDeviceInfoLength {
+		runes = runes[:maxDeviceInfoLength]
+	}
+	return string(runes)
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
+)
+
+// endpoints DPoP proofs are sent to, proof is bound to URI of the endpoint
+const (
+	tokenEndpoint    = "/oauth2/v1/token"
+	userInfoEndpoint = "/oauth2/v1/userinfo"
+	parEndpoint      = "/oauth2/v1/par"
+)
+
+// jktValidRegex matches base64url SHA-256 JWK thumbprint
+var jktValidRegex = regexp.MustCompile("^[a-zA-Z0-9-_]{43}$")
+
+// isValidJkt checks thumbprint sent by client at login, tokens are issued without binding when it is empty
+func isValidJkt(jkt string) bool {
+	if jkt == "" {
+		return true
+	}
+	_, err := validateRegex(jktValidRegex, jkt)
+	return err == nil
+}
+
+// accessToken returns scheme and token of Authorization header, DPoP-bound tokens are sent with DPoP scheme
+func accessToken(r *http.Request) (string, string) {
+	header := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer", oauthserver.TokenTypeDPoP} {
+		if strings.HasPrefix(header, scheme+" ") {
+			return scheme, strings.TrimPrefix(header, scheme+" ")
+		}
+	}
+	return "", ""
+}
+
+// dpopChallenge is WWW-Authenticate challenge of DPoP scheme (RFC 9449 section 7.1)
+func dpopChallenge(code string) string {
+	challenge := `DPoP realm="oauth2"`
+	if code != "" {
+		challenge += fmt.Sprintf(`, error="%s"`, code)
+	}
+	return challenge + fmt.Sprintf(`, algs="%s"`, strings.Join(verifier.ProofAlgorithms, " "))
+}
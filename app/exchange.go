@@ -0,0 +1,126 @@
+package app
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/adminbackend"
+	nebulaAuthHandler "github.com/shieldoo/shieldoo-mesh-oauth/handler"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// exchangeToken issues token for another audience to user of Shieldoo token or upstream id_token (RFC 8693),
+// user is authorized by admin backend of the target audience as at login, issued token is bound to DPoP key jkt
+// of the client when set
+func exchangeToken(client *utils.Client, form url.Values, jkt string) (*oauthserver.TokenResponse, error) {
+	audience := form.Get("audience")
+	if audience == "" {
+		return nil, oauthserver.ErrInvalidRequest("missing audience")
+	}
+	if _, err := validateRegex(audienceValidRegex, audience); err != nil {
+		return nil, oauthserver.ErrInvalidTarget("invalid audience")
+	}
+	if !oauthserver.IsExchangeAudienceAllowed(client, audience) {
+		return nil, oauthserver.ErrInvalidTarget("client is not allowed to exchange tokens for audience " + audience)
+	}
+	if form.Get("actor_token") != "" {
+		return nil, oauthserver.ErrInvalidRequest("actor_token is not supported")
+	}
+
+	params, err := subjectParams(client, form.Get("subject_token"), form.Get("subject_token_type"), jkt)
+	if err != nil {
+		return nil, err
+	}
+	if !oauthserver.IsProviderAllowed(client, params.Provider) {
+		return nil, oauthserver.ErrInvalidGrant("subject token was issued for provider not allowed for client")
+	}
+	params.Audience = audience
+	params.ClientId = client.ClientId
+
+	userDetails, err := nebulaAuthHandler.AuthorizeUser(params.Upn, params)
+	if err != nil {
+		if errors.Is(err, adminbackend.ErrUserNotFound) {
+			log.WithFields(log.Fields{
+				"upn":      params.Upn,
+				"audience": audience,
+			}).Warn("Token exchange rejected, user is not member of audience")
+			return nil, oauthserver.ErrInvalidGrant("user is not authorized for audience")
+		}
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"clientId": client.ClientId,
+		"upn":      params.Upn,
+		"provider": params.Provider,
+		"audience": audience,
+	}).Info("Token exchanged")
+	return oauthserver.ExchangeToken(client, params, userDetails, form.Get("requested_token_type"), jkt)
+}
+
+// subjectParams returns user of subject token, Shieldoo access tokens are accepted for access_token and jwt
+// token types, Shieldoo id_token and id_token of upstream provider for id_token type, token bound to DPoP key
+// is accepted only with proof of the key jkt
+func subjectParams(client *utils.Client, token string, tokenType string, jkt string) (*model.Params, error) {
+	if token == "" || tokenType == "" {
+		return nil, oauthserver.ErrInvalidRequest("missing subject_token or subject_token_type")
+	}
+	if tokenType != oauthserver.TokenTypeAccessToken && tokenType != oauthserver.TokenTypeJwt && tokenType != oauthserver.TokenTypeIdToken {
+		return nil, oauthserver.ErrInvalidRequest("unsupported subject_token_type")
+	}
+
+	var payload *oauthserver.Payload
+	var err error
+	if tokenType == oauthserver.TokenTypeIdToken {
+		payload, err = oauthserver.VerifyIdToken(token)
+	} else {
+		payload, err = oauthserver.VerifyToken(token)
+	}
+	if err == nil {
+		// tokens of client_credentials grant represent client, not user of provider
+		if payload.Provider == "" {
+			return nil, oauthserver.ErrInvalidGrant("subject token does not represent user")
+		}
+		if !oauthserver.IsSubjectTokenAllowed(client, payload) {
+			log.WithFields(log.Fields{
+				"clientId": client.ClientId,
+				"upn":      payload.Upn,
+				"audience": payload.Aud,
+			}).Warn("Token exchange rejected, subject token was not issued to client")
+			return nil, oauthserver.ErrInvalidGrant("subject token was not issued to client")
+		}
+		if payload.Confirmation != nil && payload.Confirmation.Jkt != jkt {
+			log.WithFields(log.Fields{
+				"upn": payload.Upn,
+			}).Warn("Token exchange rejected, subject token is bound to another DPoP key")
+			return nil, oauthserver.ErrInvalidGrant("subject token is bound to DPoP key, proof of the key is required")
+		}
+		return &model.Params{
+			Upn:      payload.Upn,
+			Name:     payload.Name,
+			Provider: payload.Provider,
+			Tenant:   payload.Tenant,
+			// exchanged token ends with session of subject token
+			SessionId: payload.SessionId,
+		}, nil
+	}
+	if tokenType != oauthserver.TokenTypeIdToken {
+		log.Debug("Subject token rejected: ", err)
+		return nil, oauthserver.ErrInvalidGrant("invalid subject token")
+	}
+
+	identity, provider, err := oauthclient.ValidateIdToken(token)
+	if err != nil {
+		log.Debug("Subject id_token rejected: ", err)
+		return nil, oauthserver.ErrInvalidGrant("invalid subject token")
+	}
+	return &model.Params{
+		Upn:      identity.Upn,
+		Name:     identity.Name,
+		Provider: provider,
+		Tenant:   identity.Tenant,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// oauthLogout is OpenID Connect RP-initiated logout endpoint, session of id_token_hint is ended and user
+// is redirected to registered post logout redirect URI, optionally through logout of upstream provider
+func oauthLogout(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit: /oauth2/v1/logout")
+	if err := r.ParseForm(); err != nil {
+		utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientId := r.Form.Get("client_id")
+	var payload *oauthserver.Payload
+	if hint := r.Form.Get("id_token_hint"); hint != "" {
+		var err error
+		payload, err = oauthserver.VerifyIdTokenHint(hint)
+		if err != nil {
+			log.Warn("Logout with invalid id_token_hint: ", err)
+			utils.GeneralResponseTemplate(w, "Invalid id_token_hint parameter", http.StatusBadRequest)
+			return
+		}
+		if clientId == "" {
+			clientId = payload.Aud
+		} else if clientId != payload.Aud {
+			utils.GeneralResponseTemplate(w, "id_token_hint was not issued to the client", http.StatusBadRequest)
+			return
+		}
+	}
+	var client *utils.Client
+	if clientId != "" {
+		if client = oauthserver.FindClient(clientId); client == nil {
+			utils.GeneralResponseTemplate(w, "Unknown client_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	redirect := r.Form.Get("post_logout_redirect_uri")
+	if redirect != "" {
+		if client == nil {
+			utils.GeneralResponseTemplate(w, "Missing client_id or id_token_hint parameter", http.StatusBadRequest)
+			return
+		}
+		if !oauthserver.IsValidPostLogoutRedirectUri(client, redirect) {
+			utils.GeneralResponseTemplate(w, "Not registered post_logout_redirect_uri parameter", http.StatusBadRequest)
+			return
+		}
+		if state := r.Form.Get("state"); state != "" {
+			var err error
+			if redirect, err = utils.AddQueryParams(redirect, map[string]string{"state": state}); err != nil {
+				utils.GeneralResponseTemplate(w, "Invalid post_logout_redirect_uri parameter", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	// without id_token_hint there is no session to end, user is only redirected
+	if payload != nil {
+		if err := oauthserver.EndSession(payload); err != nil {
+			log.Error("Unable to end session: ", err)
+			utils.GeneralResponseTemplate(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.WithFields(log.Fields{
+			"clientId": clientId,
+			"upn":      payload.Upn,
+		}).Info("User logged out")
+
+		if client.UpstreamLogout {
+			upstream, err := oauthclient.GetLogoutUrl(payload.Provider, redirect)
+			if err == nil {
+				http.Redirect(w, r, upstream, http.StatusFound)
+				return
+			}
+			if !errors.Is(err, oauthclient.ErrLogoutNotSupported) {
+				log.Warn("Unable to sign out of upstream provider ", payload.Provider, ": ", err)
+			}
+		}
+	}
+
+	if redirect != "" {
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+	utils.GeneralResponseTemplate(w, "You have been signed out. Now you can close your browser.", http.StatusOK)
+}
@@ -0,0 +1,350 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/adminbackend"
+	nebulaAuthHandler "github.com/shieldoo/shieldoo-mesh-oauth/handler"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// oauthAuthorize is OAuth 2.0 authorization endpoint, validated request is kept server-side while user signs in,
+// parameters pushed by the client are used when request_uri is sent (RFC 9126 section 4)
+func oauthAuthorize(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit: /oauth2/v1/authorize")
+	if err := r.ParseForm(); err != nil {
+		utils.GeneralResponseTemplate(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// errors related to client or redirect URI can not be sent to the client
+	client := oauthserver.FindClient(r.Form.Get("client_id"))
+	if client == nil {
+		utils.GeneralResponseTemplate(w, "Missing or unknown client_id parameter", http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+	requestUri := r.Form.Get("request_uri")
+	if requestUri != "" {
+		pushed, err := oauthserver.GetPushedAuthorizationRequest(client.ClientId, oauthserver.PushedAuthorization, requestUri, true)
+		if err != nil {
+			utils.GeneralResponseTemplate(w, "Invalid or expired request_uri parameter", http.StatusBadRequest)
+			return
+		}
+		params = pushed
+	}
+	redirectUri := params.Get("redirect_uri")
+	if !oauthserver.IsValidRedirectUri(client, redirectUri) {
+		utils.GeneralResponseTemplate(w, "Missing or not registered redirect_uri parameter", http.StatusBadRequest)
+		return
+	}
+
+	request, err := newAuthorizationRequest(client, params)
+	if err != nil {
+		redirectAuthorizeError(w, r, request, err.Code, err.Description)
+		return
+	}
+	if requestUri == "" && oauthserver.IsPushedRequestRequired(client) {
+		redirectAuthorizeError(w, r, request, "invalid_request", "pushed authorization request is required")
+		return
+	}
+
+	id, storeErr := oauthserver.CreateAuthorizationRequest(request)
+	if storeErr != nil {
+		log.Error("Unable to store authorization request: ", storeErr)
+		redirectAuthorizeError(w, r, request, "server_error", "")
+		return
+	}
+	renderLogin(w, &model.Params{Audience: request.Audience, Request: id, ClientId: client.ClientId}, client)
+}
+
+// newAuthorizationRequest validates authorization request of the client with registered redirect URI,
+// request is returned with error too so the error can be redirected to the client
+func newAuthorizationRequest(client *utils.Client, params url.Values) (*oauthserver.AuthorizationRequest, *oauthserver.OAuthError) {
+	request := &oauthserver.AuthorizationRequest{
+		ClientId:            client.ClientId,
+		RedirectUri:         params.Get("redirect_uri"),
+		Scope:               params.Get("scope"),
+		State:               params.Get("state"),
+		Nonce:               params.Get("nonce"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+		Audience:            oauthserver.ClientAudience(client),
+		DPoPJkt:             params.Get("dpop_jkt"),
+	}
+	if !oauthserver.IsGrantTypeAllowed(client, oauthserver.GrantTypeAuthorizationCode) {
+		return request, oauthserver.ErrUnauthorizedClient("client is not allowed to use authorization code grant")
+	}
+	if params.Get("response_type") != oauthserver.ResponseTypeCode {
+		return request, oauthserver.NewOAuthError("unsupported_response_type", "only response_type code is supported", http.StatusBadRequest)
+	}
+	if request.CodeChallenge != "" && request.CodeChallengeMethod != oauthserver.CodeChallengeMethodS256 {
+		return request, oauthserver.ErrInvalidRequest("only S256 code_challenge_method is supported")
+	}
+	if request.CodeChallenge == "" && oauthserver.IsPublicClient(client) {
+		return request, oauthserver.ErrInvalidRequest("code_challenge is required for public clients")
+	}
+	if !isValidJkt(request.DPoPJkt) {
+		return request, oauthserver.ErrInvalidRequest("invalid dpop_jkt")
+	}
+	return request, nil
+}
+
+func redirectAuthorizeError(w http.ResponseWriter, r *http.Request, request *oauthserver.AuthorizationRequest, code string, description string) {
+	query := map[string]string{"error": code, "iss": _cfg.OAuthServer.Issuer}
+	if description != "" {
+		query["error_description"] = description
+	}
+	if request.State != "" {
+		query["state"] = request.State
+	}
+	redirect, err := utils.AddQueryParams(request.RedirectUri, query)
+	if err != nil {
+		utils.GeneralResponseTemplate(w, "Invalid redirect_uri parameter", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// oauthToken is OAuth 2.0 token endpoint
+func oauthToken(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /oauth2/v1/token")
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthserver.ErrInvalidRequest(err.Error()))
+		return
+	}
+	client, err := oauthserver.AuthenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	// tokens are bound to DPoP key of the client when proof is sent (RFC 9449 section 5)
+	jkt, err := oauthserver.VerifyDPoPProof(r, tokenEndpoint, "")
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	if jkt == "" && oauthserver.IsDPoPRequired(client) {
+		writeOAuthError(w, oauthserver.ErrInvalidDPoPProof("DPoP proof is required for the client"))
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	if oauthserver.IsGrantTypeSupported(grantType) && !oauthserver.IsGrantTypeAllowed(client, grantType) {
+		writeOAuthError(w, oauthserver.ErrUnauthorizedClient("client is not allowed to use "+grantType+" grant"))
+		return
+	}
+
+	var response *oauthserver.TokenResponse
+	switch grantType {
+	case oauthserver.GrantTypeAuthorizationCode:
+		var authCode *oauthserver.AuthorizationCode
+		authCode, err = oauthserver.RedeemAuthorizationCode(r.PostForm.Get("code"), client,
+			r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+		if err == nil {
+			response, err = oauthserver.ExchangeAuthorizationCode(client, authCode, jkt)
+		}
+	case oauthserver.GrantTypeRefreshToken:
+		response, err = exchangeRefreshToken(client, r.PostForm.Get("refresh_token"), r.PostForm.Get("scope"), jkt)
+	case oauthserver.GrantTypeClientCredentials:
+		response, err = oauthserver.ExchangeClientCredentials(client, jkt)
+	case oauthserver.GrantTypeDeviceCode:
+		response, err = oauthserver.ExchangeDeviceCode(client, r.PostForm.Get("device_code"), jkt)
+	case oauthserver.GrantTypeTokenExchange:
+		response, err = exchangeToken(client, r.PostForm, jkt)
+	default:
+		err = oauthserver.ErrUnsupportedGrantType("grant_type is not supported")
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"clientId":  client.ClientId,
+		"grantType": grantType,
+		"tokenType": response.TokenType,
+	}).Info("Token issued")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJson(w, http.StatusOK, response)
+}
+
+// oauthIntrospect is OAuth 2.0 token introspection endpoint (RFC 7662) for resource servers registered
+// as confidential clients
+func oauthIntrospect(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /oauth2/v1/introspect")
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthserver.ErrInvalidRequest(err.Error()))
+		return
+	}
+	client, err := oauthserver.AuthenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	if oauthserver.IsPublicClient(client) {
+		writeOAuthError(w, oauthserver.ErrInvalidClient("public client can not introspect tokens"))
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, oauthserver.ErrInvalidRequest("missing token"))
+		return
+	}
+
+	response := oauthserver.Introspect(client, token, r.PostForm.Get("token_type_hint"))
+	log.WithFields(log.Fields{
+		"clientId": client.ClientId,
+		"active":   response.Active,
+		"upn":      response.Upn,
+	}).Debug("Token introspected")
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, http.StatusOK, response)
+}
+
+// oauthRevoke is OAuth 2.0 token revocation endpoint (RFC 7009), unknown tokens and tokens of other clients
+// are ignored so response does not reveal anything about the token
+func oauthRevoke(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /oauth2/v1/revoke")
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthserver.ErrInvalidRequest(err.Error()))
+		return
+	}
+	client, err := oauthserver.AuthenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, oauthserver.ErrInvalidRequest("missing token"))
+		return
+	}
+	if err := oauthserver.RevokeClientToken(client, token, r.PostForm.Get("token_type_hint")); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// oauthUserInfo is OpenID Connect userinfo endpoint protected by access token in Authorization header,
+// DPoP-bound token is accepted with DPoP proof of its key
+func oauthUserInfo(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit: /oauth2/v1/userinfo")
+	scheme, token := accessToken(r)
+	if token == "" {
+		// request without authentication gets challenge without error code (RFC 6750 section 3.1)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth2"`)
+		w.Header().Add("WWW-Authenticate", dpopChallenge(""))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	payload, err := oauthserver.VerifyToken(token)
+	if err == nil {
+		err = oauthserver.VerifyTokenBinding(r, userInfoEndpoint, scheme, token, payload)
+	} else {
+		err = oauthserver.NewOAuthError("invalid_token", "token is not valid", http.StatusUnauthorized)
+	}
+	if err != nil {
+		writeBearerError(w, scheme, err)
+		return
+	}
+
+	details, err := nebulaAuthHandler.AuthorizeUser(payload.Upn, payload.TokenParams())
+	if err != nil {
+		if errors.Is(err, adminbackend.ErrUserNotFound) {
+			writeBearerError(w, scheme, oauthserver.NewOAuthError("invalid_token", "user is no longer authorized", http.StatusUnauthorized))
+			return
+		}
+		writeBearerError(w, scheme, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, http.StatusOK, oauthserver.NewUserInfo(payload, details))
+}
+
+// exchangeRefreshToken rotates refresh token, user is authorized again because user could be removed
+// from the organisation or roles could change since login
+func exchangeRefreshToken(client *utils.Client, token string, scope string, jkt string) (*oauthserver.TokenResponse, error) {
+	if token == "" {
+		return nil, oauthserver.ErrInvalidRequest("missing refresh_token")
+	}
+	refresh, err := oauthserver.RedeemRefreshToken(token, client)
+	if err != nil {
+		return nil, err
+	}
+	var response *oauthserver.TokenResponse
+	userDetails, err := nebulaAuthHandler.AuthorizeUser(refresh.Params.Upn, &refresh.Params)
+	if errors.Is(err, adminbackend.ErrUserNotFound) {
+		log.WithFields(log.Fields{
+			"upn":      refresh.Params.Upn,
+			"audience": refresh.Params.Audience,
+		}).Warn("User is no longer authorized, revoking refresh tokens")
+		if err := oauthserver.RevokeRefreshTokenFamily(refresh.FamilyId); err != nil {
+			log.Error("Unable to revoke refresh token family: ", err)
+		}
+		return nil, oauthserver.ErrInvalidGrant("user is no longer authorized")
+	}
+	if err == nil {
+		response, err = oauthserver.ExchangeRefreshToken(client, refresh, scope, userDetails, jkt)
+	}
+	if err != nil {
+		if err := oauthserver.ReleaseRefreshToken(token, refresh); err != nil {
+			log.Error("Unable to release refresh token: ", err)
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *oauthserver.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Error("OAuth error: ", err)
+		oauthErr = oauthserver.NewOAuthError("server_error", "", http.StatusInternalServerError)
+	}
+	if oauthErr.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, oauthErr.Status, oauthErr)
+}
+
+// writeBearerError sends error of resource protected by access token (RFC 6750 section 3), challenge uses
+// scheme of the token, DPoP-bound tokens get DPoP challenge (RFC 9449 section 7.1)
+func writeBearerError(w http.ResponseWriter, scheme string, err error) {
+	var oauthErr *oauthserver.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Error("OAuth error: ", err)
+		oauthErr = oauthserver.NewOAuthError("server_error", "", http.StatusInternalServerError)
+	}
+	if oauthErr.Status == http.StatusUnauthorized {
+		if scheme == oauthserver.TokenTypeDPoP {
+			w.Header().Set("WWW-Authenticate", dpopChallenge(oauthErr.Code))
+		} else {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="oauth2", error="%s"`, oauthErr.Code))
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, oauthErr.Status, oauthErr)
+}
+
+func writeJson(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	if err := encoder.Encode(data); err != nil {
+		log.Error("json error: ", err)
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// parameters kept by pushed authorization request, other parameters are dropped
+var (
+	pushedAuthorizationParams = []string{
+		"redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method", "dpop_jkt",
+	}
+	pushedLoginParams = []string{"audience", "redirect", "state", "aad_tenant_id", "dpop_jkt"}
+)
+
+// oauthPushedAuthorizationRequest is pushed authorization request endpoint (RFC 9126), authenticated client
+// pushes OAuth authorization request or parameters of login page and sends user with returned request_uri only
+func oauthPushedAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /oauth2/v1/par")
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthserver.ErrInvalidRequest(err.Error()))
+		return
+	}
+	client, err := oauthserver.AuthenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	if r.PostForm.Get("request_uri") != "" {
+		writeOAuthError(w, oauthserver.ErrInvalidRequest("request_uri can not be pushed"))
+		return
+	}
+	// DPoP proof of pushed request binds authorization code to the key (RFC 9449 section 10.1)
+	jkt, err := oauthserver.VerifyDPoPProof(r, parEndpoint, "")
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	if jkt != "" {
+		if r.PostForm.Get("dpop_jkt") != "" && r.PostForm.Get("dpop_jkt") != jkt {
+			writeOAuthError(w, oauthserver.ErrInvalidDPoPProof("dpop_jkt does not match DPoP proof"))
+			return
+		}
+		r.PostForm.Set("dpop_jkt", jkt)
+	}
+
+	kind, names := oauthserver.PushedLogin, pushedLoginParams
+	if r.PostForm.Get("response_type") != "" {
+		if !oauthserver.IsValidRedirectUri(client, r.PostForm.Get("redirect_uri")) {
+			writeOAuthError(w, oauthserver.ErrInvalidRequest("missing or not registered redirect_uri"))
+			return
+		}
+		if _, err := newAuthorizationRequest(client, r.PostForm); err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		kind, names = oauthserver.PushedAuthorization, pushedAuthorizationParams
+	} else if err := validatePushedLogin(client, r.PostForm); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	params := url.Values{}
+	for _, name := range names {
+		if value := r.PostForm.Get(name); value != "" {
+			params.Set(name, value)
+		}
+	}
+
+	response, err := oauthserver.PushAuthorizationRequest(client, kind, params)
+	if err != nil {
+		log.Error("Unable to store pushed authorization request: ", err)
+		writeOAuthError(w, oauthserver.NewOAuthError("server_error", "", http.StatusInternalServerError))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, http.StatusCreated, response)
+}
+
+// validatePushedLogin validates parameters of login page, audience is given by the client
+func validatePushedLogin(client *utils.Client, form url.Values) error {
+	if !isValidJkt(form.Get("dpop_jkt")) {
+		return oauthserver.ErrInvalidRequest("invalid dpop_jkt")
+	}
+	if state := form.Get("state"); state != "" {
+		if _, err := validateRegex(codeValidRegex, state); err != nil {
+			return oauthserver.ErrInvalidRequest("invalid state")
+		}
+	}
+	audience := form.Get("audience")
+	if audience != "" && audience != oauthserver.ClientAudience(client) {
+		return oauthserver.ErrInvalidRequest("audience is not allowed for the client")
+	}
+	return nil
+}
+
+// pushedLogin returns parameters of login page pushed by the client, pushed request is consumed when user
+// leaves to identity provider
+func pushedLogin(clientId string, requestUri string, consume bool) (*model.Params, error) {
+	pushed, err := oauthserver.GetPushedAuthorizationRequest(clientId, oauthserver.PushedLogin, requestUri, consume)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Params{
+		Code:       pushed.Get("state"),
+		Audience:   pushed.Get("audience"),
+		Redirect:   pushed.Get("redirect"),
+		Tenant:     pushed.Get("aad_tenant_id"),
+		Jkt:        pushed.Get("dpop_jkt"),
+		ClientId:   clientId,
+		RequestUri: requestUri,
+	}, nil
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	log "github.com/sirupsen/logrus"
+)
+
+// oauthRegister is dynamic client registration endpoint (RFC 7591) protected by initial access token,
+// registered client waits for approval of administrator
+func oauthRegister(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Endpoint Hit (POST): /oauth2/v1/register")
+	if !oauthserver.IsValidInitialAccessToken(bearerToken(r)) {
+		log.Warn("Client registration with invalid initial access token")
+		writeBearerError(w, "Bearer", oauthserver.NewOAuthError("invalid_token", "invalid initial access token", http.StatusUnauthorized))
+		return
+	}
+	metadata, err := decodeClientMetadata(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	response, err := oauthserver.RegisterClient(&metadata.ClientMetadata)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, http.StatusCreated, response)
+}
+
+// oauthClientConfiguration is client configuration endpoint (RFC 7592) protected by registration access token
+func oauthClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	clientId := mux.Vars(r)["client_id"]
+	log.Debug("Endpoint Hit (" + r.Method + "): /oauth2/v1/register/" + clientId)
+	client, err := oauthserver.AuthenticateRegistration(clientId, bearerToken(r))
+	if err != nil {
+		writeBearerError(w, "Bearer", err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, http.StatusOK, oauthserver.NewClientInformation(client))
+	case http.MethodPut:
+		metadata, err := decodeClientMetadata(r)
+		if err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		if metadata.ClientId != clientId {
+			writeOAuthError(w, oauthserver.ErrInvalidRequest("client_id does not match"))
+			return
+		}
+		response, err := oauthserver.UpdateRegisteredClient(client, &metadata.ClientMetadata)
+		if err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		writeJson(w, http.StatusOK, response)
+	case http.MethodDelete:
+		if err := oauthserver.DeleteClient(clientId); err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		log.WithFields(log.Fields{
+			"clientId": clientId,
+		}).Info("OAuth client registration deleted")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// clientMetadataRequest is client metadata, client id is sent at update (RFC 7592 section 2.2)
+type clientMetadataRequest struct {
+	ClientId string `json:"client_id"`
+	oauthserver.ClientMetadata
+}
+
+func decodeClientMetadata(r *http.Request) (*clientMetadataRequest, error) {
+	request := &clientMetadataRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		return nil, oauthserver.ErrInvalidClientMetadata(err.Error())
+	}
+	if request.Audience != "" {
+		if _, err := validateRegex(audienceValidRegex, request.Audience); err != nil {
+			return nil, oauthserver.ErrInvalidClientMetadata("invalid audience")
+		}
+	}
+	return request, nil
+}
+
+// bearerToken returns token from Authorization header, empty string when header does not contain bearer token
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(header, "Bearer ")
+}
@@ -13,6 +13,16 @@ import (
 )
 
 func HandleAuthorization(w http.ResponseWriter, upn string, params *model.Params) (*model.SysApiUserDetail, error) {
+	details, err := AuthorizeUser(upn, params)
+	if err != nil {
+		handleError(w, upn, params, err)
+		return nil, err
+	}
+	return details, nil
+}
+
+// AuthorizeUser returns user details from admin backend of the audience, nil details when audience is not authorized
+func AuthorizeUser(upn string, params *model.Params) (*model.SysApiUserDetail, error) {
 	staticAudience := utils.FindStaticAudience(*_cfg, params.Audience)
 	if staticAudience != nil {
 		if !staticAudience.Authorize {
@@ -27,21 +37,11 @@ func HandleAuthorization(w http.ResponseWriter, upn string, params *model.Params
 				"audience": params.Audience,
 				"url":      staticAudience.AuthorizeUrl,
 			}).Info("Authorizing audience with custom admin backend")
-			details, err := adminbackend.GetUserDetails(upn, params, staticAudience.AuthorizeUrl)
-			if err != nil {
-				handleError(w, upn, params, err)
-				return nil, err
-			}
-			return details, nil
+			return adminbackend.GetUserDetails(upn, params, staticAudience.AuthorizeUrl)
 		}
 	}
 	// Default admin backend for non-static audiences and static audiences without custom admin backend
-	details, err := adminbackend.GetUserDetailsWithDefaultBackend(upn, params)
-	if err != nil {
-		handleError(w, upn, params, err)
-		return nil, err
-	}
-	return details, nil
+	return adminbackend.GetUserDetailsWithDefaultBackend(upn, params)
 }
 
 func handleError(w http.ResponseWriter, upn string, params *model.Params, err error) {
@@ -18,6 +18,15 @@ const (
 )
 
 func HandleOauth(w http.ResponseWriter, r *http.Request, params *model.Params, userDetails *model.SysApiUserDetail) {
+	if params.Request != "" {
+		handleAuthorizationCode(w, r, params, userDetails)
+		return
+	}
+	if params.UserCode != "" {
+		handleDeviceAuthorization(w, params, userDetails)
+		return
+	}
+
 	jwt, _, err := oauthserver.CreateToken(params, userDetails)
 	if err != nil {
 		utils.GeneralResponseTemplate(w, SERVER_ERROR, http.StatusInternalServerError)
@@ -60,3 +69,40 @@ func HandleOauth(w http.ResponseWriter, r *http.Request, params *model.Params, u
 		http.Redirect(w, r, u.String(), http.StatusFound)
 	}
 }
+
+// handleAuthorizationCode finishes authorization request of OAuth client by redirecting user back with code
+func handleAuthorizationCode(w http.ResponseWriter, r *http.Request, params *model.Params, userDetails *model.SysApiUserDetail) {
+	code, request, err := oauthserver.CreateAuthorizationCode(params, userDetails)
+	if err != nil {
+		utils.GeneralResponseTemplate(w, "Login request has expired, please try it again.", http.StatusBadRequest)
+		log.Warn("Unable to create authorization code: ", err)
+		return
+	}
+
+	query := map[string]string{"code": code, "iss": _cfg.OAuthServer.Issuer}
+	if request.State != "" {
+		query["state"] = request.State
+	}
+	redirect, err := utils.AddQueryParams(request.RedirectUri, query)
+	if err != nil {
+		utils.GeneralResponseTemplate(w, SERVER_ERROR, http.StatusInternalServerError)
+		log.Error("OAuth error: ", err)
+		return
+	}
+	log.WithFields(log.Fields{
+		"upn":      params.Upn,
+		"clientId": request.ClientId,
+	}).Info("Authorization code issued")
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// handleDeviceAuthorization approves device authorization confirmed by signed in user, device gets tokens
+// on its next poll of token endpoint
+func handleDeviceAuthorization(w http.ResponseWriter, params *model.Params, userDetails *model.SysApiUserDetail) {
+	if err := oauthserver.ApproveDeviceAuthorization(params.UserCode, params, userDetails); err != nil {
+		utils.GeneralResponseTemplate(w, "Device sign in request has expired, please try it again.", http.StatusBadRequest)
+		log.Warn("Unable to approve device authorization: ", err)
+		return
+	}
+	utils.RenderTemplate(w, "general", &model.Message{Message: "Your device is signed in. Now you can close your browser and go back to your device."})
+}
@@ -15,8 +15,46 @@ type Params struct {
 	Tenant   string `json:"tenant,omitempty"`
 	Provider string `json:"provider,omitempty"`
 	Redirect string `json:"redirect,omitempty"`
+	Request  string `json:"request,omitempty"`
+	ClientId string `json:"client_id,omitempty"`
+	UserCode string `json:"user_code,omitempty"`
+	// RequestUri references login parameters pushed by the client, parameters are not sent by browser then
+	RequestUri string `json:"request_uri,omitempty"`
+	// SessionId identifies sign in of the user, tokens of the session are revoked at logout
+	SessionId string `json:"sid,omitempty"`
+	// Jkt is thumbprint of DPoP key of the client, access tokens are bound to the key
+	Jkt string `json:"jkt,omitempty"`
 }
 
 type Message struct {
 	Message string
 }
+
+// DevicePage is page where user enters and confirms user code of device authorization, Params are set
+// for device login started by Shieldoo client with state code
+type DevicePage struct {
+	UserCode   string
+	ClientName string
+	DeviceName string
+	DeviceOs   string
+	Error      string
+	Params     *Params
+	Csrf       string
+}
+
+type LoginProvider struct {
+	Name        string
+	DisplayName string
+}
+
+type LoginPage struct {
+	*Params
+	Providers []LoginProvider
+}
+
+// Identity is user authenticated by upstream provider
+type Identity struct {
+	Upn    string
+	Name   string
+	Tenant string
+}
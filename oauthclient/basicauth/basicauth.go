@@ -0,0 +1,52 @@
+package basicauth
+
+import (
+	"net/http"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const Name = "basicauth"
+
+// Provider authenticates users against htpasswd list from configuration using HTTP basic authentication
+type Provider struct {
+	callbackUrl string
+}
+
+func New(cfg *utils.Config) *Provider {
+	return &Provider{callbackUrl: cfg.Server.Uri + "/callback/" + Name}
+}
+
+func (p *Provider) Name() string {
+	return Name
+}
+
+func (p *Provider) DisplayName() string {
+	return "Username and password"
+}
+
+func (p *Provider) GetAuthorizeUrl(login *oauthclient.LoginRequest, params *model.Params) (string, error) {
+	return utils.AddQueryParams(p.callbackUrl, map[string]string{"state": login.State})
+}
+
+func (p *Provider) HandleCallback(login *oauthclient.LoginRequest, w http.ResponseWriter, r *http.Request) (*model.Identity, error) {
+	// get username and password from basic auth
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		log.Debug("Endpoint Hit: /callback/basicauth with missing basic auth")
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		return nil, oauthclient.ErrUnauthorized
+	}
+
+	// check if user exists in array of htaccess users
+	if !utils.CheckHtaccessUser(username, password) {
+		log.Debug("Endpoint Hit: /callback/basicauth with invalid basic auth")
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		return nil, oauthclient.ErrUnauthorized
+	}
+
+	return &model.Identity{Upn: username}, nil
+}
@@ -2,11 +2,8 @@ package oauthclient
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 
-	"github.com/shieldoo/shieldoo-mesh-oauth/model"
 	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
@@ -16,13 +13,7 @@ var _cfg *utils.Config
 
 func Init(cfg *utils.Config) {
 	_cfg = cfg
-	InitMicrosoft(cfg)
-	InitGoogle(cfg)
-	var err error
-	if err != nil {
-		log.Panic("Unable initialize OauthClient: ", err)
-		os.Exit(1000)
-	}
+	initState(cfg)
 }
 
 type Jwks struct {
@@ -38,8 +29,10 @@ type JSONWebKeys struct {
 	X5c []string `json:"x5c"`
 }
 
-func exchangeCode(code string, oauthConfig *oauth2.Config) (*oauth2.Token, error) {
-	token, err := oauthConfig.Exchange(context.Background(), code)
+// ExchangeCode exchanges authorization code for tokens, PKCE verifier of the login is sent with the code
+func ExchangeCode(code string, oauthConfig *oauth2.Config, login *LoginRequest) (*oauth2.Token, error) {
+	token, err := oauthConfig.Exchange(context.Background(), code,
+		oauth2.SetAuthURLParam("code_verifier", login.CodeVerifier))
 	if err != nil {
 		log.Error("code exchange failed: ", err.Error())
 		return nil, err
@@ -47,7 +40,7 @@ func exchangeCode(code string, oauthConfig *oauth2.Config) (*oauth2.Token, error
 	return token, nil
 }
 
-func extractIdToken(tokenResponse *oauth2.Token) (string, error) {
+func ExtractIdToken(tokenResponse *oauth2.Token) (string, error) {
 	idToken, ok := tokenResponse.Extra("id_token").(string)
 	if !ok {
 		log.Error("no id_token field in oauth2 token")
@@ -56,13 +49,3 @@ func extractIdToken(tokenResponse *oauth2.Token) (string, error) {
 
 	return idToken, nil
 }
-
-func decodeParams(state string) (*model.Params, error) {
-	var params model.Params
-	err := json.Unmarshal([]byte(state), &params)
-	if err != nil {
-		log.Error(err)
-		return nil, err
-	}
-	return &params, nil
-}
@@ -0,0 +1,116 @@
+package google
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	"golang.org/x/oauth2"
+	googleoauth "golang.org/x/oauth2/google"
+	"google.golang.org/api/idtoken"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const Name = "google"
+
+type Provider struct {
+	clientId    string
+	oauthConfig *oauth2.Config
+}
+
+func New(cfg *utils.Config) *Provider {
+	return &Provider{
+		clientId: cfg.Google.ClientId,
+		oauthConfig: &oauth2.Config{
+			RedirectURL:  cfg.Server.Uri + "/" + cfg.Google.CallbackUrl,
+			ClientID:     cfg.Google.ClientId,
+			ClientSecret: cfg.Google.ClientSecret,
+			Scopes:       []string{"openid", "email"},
+			Endpoint:     googleoauth.Endpoint,
+		},
+	}
+}
+
+func (p *Provider) Name() string {
+	return Name
+}
+
+func (p *Provider) DisplayName() string {
+	return "Google"
+}
+
+func (p *Provider) HandleCallback(login *oauthclient.LoginRequest, w http.ResponseWriter, request *http.Request) (*model.Identity, error) {
+
+	code := request.FormValue("code")
+	tokenResponse, error := oauthclient.ExchangeCode(code, p.oauthConfig, login)
+	if error != nil {
+		return nil, error
+	}
+
+	idToken, error := oauthclient.ExtractIdToken(tokenResponse)
+	if error != nil {
+		return nil, error
+	}
+
+	payload, error := validate(idToken, p.clientId)
+	if error != nil {
+		return nil, error
+	}
+	if error := login.VerifyNonce(payload.Claims["nonce"]); error != nil {
+		return nil, error
+	}
+
+	return populateUpn(&model.Identity{}, payload), nil
+}
+
+// IsIssuer returns true for issuers of Google id_tokens
+func (p *Provider) IsIssuer(issuer string) bool {
+	return issuer == "accounts.google.com" || issuer == "https://accounts.google.com"
+}
+
+// ValidateIdToken returns user of id_token issued by Google to this server
+func (p *Provider) ValidateIdToken(idToken string) (*model.Identity, error) {
+	payload, error := validate(idToken, p.clientId)
+	if error != nil {
+		return nil, error
+	}
+	return populateUpn(&model.Identity{}, payload), nil
+}
+
+func (p *Provider) GetAuthorizeUrl(login *oauthclient.LoginRequest, params *model.Params) (string, error) {
+	returnUrl := p.oauthConfig.AuthCodeURL(
+		login.State, append(login.AuthCodeOptions(), oauth2.AccessTypeOffline,
+			oauth2.SetAuthURLParam("prompt", "select_account"),
+			oauth2.SetAuthURLParam("response_mode", "form_post"), //Not supported but allowed by google. More secure.
+		)...,
+	)
+
+	log.Debug("URL prepared to redirect: " + returnUrl)
+	return returnUrl, nil
+}
+
+func getClaimValue(claimName string, payload *idtoken.Payload) string {
+	return payload.Claims[claimName].(string)
+}
+
+func validate(idToken string, audience string) (*idtoken.Payload, error) {
+	payload, error := idtoken.Validate(context.Background(), idToken, audience)
+	if error != nil {
+		log.Error(error)
+		return nil, error
+	}
+	return payload, error
+}
+
+func populateUpn(identity *model.Identity, payload *idtoken.Payload) *model.Identity {
+	upn := getClaimValue("email", payload)
+	log.WithFields(log.Fields{
+		"upn": upn,
+	}).Info("User found in token")
+	identity.Upn = upn
+
+	return identity
+}
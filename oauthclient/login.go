@@ -0,0 +1,57 @@
+package oauthclient
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+var ErrInvalidNonce = errors.New("id_token nonce does not match")
+
+// LoginRequest carries per-login values protecting exchange with the provider,
+// they are kept in sealed state between authorize and callback
+type LoginRequest struct {
+	// State is opaque state parameter sent to the provider
+	State string
+	// Nonce has to be returned by the provider in id_token
+	Nonce string
+	// CodeVerifier is PKCE verifier sent in code exchange
+	CodeVerifier string
+}
+
+func newLoginRequest() *LoginRequest {
+	return &LoginRequest{
+		Nonce:        base64.RawURLEncoding.EncodeToString(utils.GenerateRandomBytes(32)),
+		CodeVerifier: base64.RawURLEncoding.EncodeToString(utils.GenerateRandomBytes(32)),
+	}
+}
+
+// CodeChallenge returns S256 PKCE challenge for the verifier
+func (l *LoginRequest) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(l.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeOptions returns PKCE challenge and nonce parameters for authorization URL
+func (l *LoginRequest) AuthCodeOptions() []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", l.CodeChallenge()),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		oauth2.SetAuthURLParam("nonce", l.Nonce),
+	}
+}
+
+// VerifyNonce checks nonce claim received in id_token
+func (l *LoginRequest) VerifyNonce(nonce interface{}) error {
+	value, ok := nonce.(string)
+	if !ok || subtle.ConstantTimeCompare([]byte(value), []byte(l.Nonce)) != 1 {
+		log.Error("JWT validate: Invalid nonce")
+		return ErrInvalidNonce
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package oauthclient
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestCodeChallenge(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		want     string
+	}{
+		// RFC 7636 appendix B
+		{name: "rfc example", verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", want: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		{name: "empty verifier", verifier: "", want: "47DEQpj8HBSa-_TImW-5JCeuQeRkm5NMpJWZG3hSuFU"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := &LoginRequest{CodeVerifier: tt.verifier}
+			if got := login.CodeChallenge(); got != tt.want {
+				t.Fatalf("challenge = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthCodeOptions(t *testing.T) {
+	login := newLoginRequest()
+	config := &oauth2.Config{ClientID: "shieldoo", Endpoint: oauth2.Endpoint{AuthURL: "https://idp.example.com/authorize"}}
+	authorizeUrl, err := url.Parse(config.AuthCodeURL("state", login.AuthCodeOptions()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorizeUrl.Query()
+	want := map[string]string{
+		"code_challenge":        login.CodeChallenge(),
+		"code_challenge_method": "S256",
+		"nonce":                 login.Nonce,
+	}
+	for name, value := range want {
+		if query.Get(name) != value {
+			t.Fatalf("%s = %s, want %s", name, query.Get(name), value)
+		}
+	}
+	if query.Get("code_verifier") != "" {
+		t.Fatal("code verifier is sent to authorization endpoint")
+	}
+	if other := newLoginRequest(); other.Nonce == login.Nonce || other.CodeVerifier == login.CodeVerifier {
+		t.Fatal("login secrets are reused")
+	}
+}
+
+func TestVerifyNonce(t *testing.T) {
+	login := &LoginRequest{Nonce: "expected-nonce"}
+	tests := []struct {
+		name    string
+		nonce   interface{}
+		wantErr bool
+	}{
+		{name: "matching", nonce: "expected-nonce"},
+		{name: "different", nonce: "another-nonce", wantErr: true},
+		{name: "missing", nonce: nil, wantErr: true},
+		{name: "not string", nonce: 42, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := login.VerifyNonce(tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidNonce) {
+				t.Fatalf("error = %v, want %v", err, ErrInvalidNonce)
+			}
+		})
+	}
+}
+
+func TestStateCarriesLoginSecrets(t *testing.T) {
+	state, cookie := testLogin(t)
+	envelope, err := openState(callbackRequest(cookie), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := envelope.loginRequest(state)
+	if login.State != state || login.Nonce == "" || login.CodeVerifier == "" {
+		t.Fatalf("login secrets are not restored from state: %+v", login)
+	}
+}
@@ -0,0 +1,282 @@
+package microsoft
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/microsoft"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+const (
+	Name      = "microsoft"
+	logoutUrl = "https://login.microsoftonline.com/common/oauth2/v2.0/logout"
+)
+
+type Provider struct {
+	clientId      string
+	jwksUri       string
+	issuerRegexps []*regexp.Regexp
+	oauthConfig   *oauth2.Config
+
+	mu                 sync.Mutex
+	cachedKey          *rsa.PublicKey
+	cachedKid          string
+	keyCachedTimestamp time.Time
+}
+
+func New(cfg *utils.Config) *Provider {
+	p := &Provider{
+		clientId: cfg.Aad.ClientId,
+		jwksUri:  cfg.Aad.JwksUri,
+	}
+	for _, issuer := range cfg.Aad.Issuers {
+		r, _ := regexp.Compile(issuer)
+		p.issuerRegexps = append(p.issuerRegexps, r)
+	}
+
+	p.oauthConfig = &oauth2.Config{
+		RedirectURL:  cfg.Server.Uri + "/" + cfg.Aad.CallbackUrl,
+		ClientID:     cfg.Aad.ClientId,
+		ClientSecret: cfg.Aad.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint:     microsoft.AzureADEndpoint(""), //TODO: Tenant
+	}
+	return p
+}
+
+func (p *Provider) Name() string {
+	return Name
+}
+
+func (p *Provider) DisplayName() string {
+	return "Microsoft"
+}
+
+func (p *Provider) HandleCallback(login *oauthclient.LoginRequest, w http.ResponseWriter, request *http.Request) (*model.Identity, error) {
+
+	code := request.FormValue("code")
+	var tokenResponse, err = oauthclient.ExchangeCode(code, p.oauthConfig, login)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := oauthclient.ExtractIdToken(tokenResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := p.validate(idToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := login.VerifyNonce(payload.Claims.(jwt.MapClaims)["nonce"]); err != nil {
+		return nil, err
+	}
+
+	return getIdentity(payload)
+}
+
+// IsIssuer returns true for Microsoft issuers accepted by configuration
+func (p *Provider) IsIssuer(issuer string) bool {
+	for _, re := range p.issuerRegexps {
+		if re.MatchString(issuer) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateIdToken returns user of id_token issued by Microsoft to this server
+func (p *Provider) ValidateIdToken(idToken string) (*model.Identity, error) {
+	payload, err := p.validate(idToken)
+	if err != nil {
+		return nil, err
+	}
+	return getIdentity(payload)
+}
+
+func (p *Provider) GetAuthorizeUrl(login *oauthclient.LoginRequest, params *model.Params) (string, error) {
+	returnUrl := p.oauthConfig.AuthCodeURL(
+		login.State, append(login.AuthCodeOptions(), oauth2.AccessTypeOffline,
+			oauth2.SetAuthURLParam("prompt", "select_account"),
+			oauth2.SetAuthURLParam("response_mode", "form_post"),
+		)...,
+	)
+
+	if params.Tenant != "" {
+		returnUrl = strings.Replace(returnUrl, "/common/", "/"+params.Tenant+"/", 1)
+	}
+
+	log.Debug("URL prepared to redirect: " + returnUrl)
+	return returnUrl, nil
+}
+
+// GetLogoutUrl returns Microsoft sign out URL, post logout redirect URI has to be registered in the application
+func (p *Provider) GetLogoutUrl(postLogoutRedirectUri string) (string, error) {
+	if postLogoutRedirectUri == "" {
+		return logoutUrl, nil
+	}
+	return utils.AddQueryParams(logoutUrl, map[string]string{"post_logout_redirect_uri": postLogoutRedirectUri})
+}
+
+func (p *Provider) certCacheExpired() bool {
+	return p.keyCachedTimestamp.Add(3600 * time.Second).Before(time.Now().UTC())
+}
+
+func (p *Provider) getKey(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("kid header not found")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cachedKid != kid || p.certCacheExpired() { //TODO: Use jwk cache instead
+		set, err := jwk.Fetch(context.Background(), p.jwksUri)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, ok := set.LookupKeyID(kid)
+		if !ok {
+			return nil, fmt.Errorf("key not found")
+		}
+
+		key := &rsa.PublicKey{}
+		err = keys.Raw(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse pubkey")
+		}
+
+		p.cachedKey = key
+		p.cachedKid = kid
+		p.keyCachedTimestamp = time.Now().UTC()
+	}
+
+	return p.cachedKey, nil
+}
+
+func (p *Provider) validate(token string) (*jwt.Token, error) {
+	parsedToken, err := jwt.Parse(token, p.getKey)
+	if err != nil {
+		log.Error("JWT: Invalid token: ", err)
+		return nil, err
+	}
+
+	claimError := parsedToken.Claims.(jwt.MapClaims).Valid()
+	if claimError != nil {
+		log.Error("JWT validate: Invalid claims: ", claimError)
+		return nil, claimError
+	}
+
+	if !parsedToken.Claims.(jwt.MapClaims).VerifyAudience(p.clientId, true) {
+		log.Error("JWT validate: Invalid audience")
+		return nil, fmt.Errorf("invalid audience")
+	}
+
+	validIssuer := false
+	// Validating using regexp is enough, because we have statically defined JWKS uri (only signed by Microsoft)
+	for _, re := range p.issuerRegexps {
+		iss := parsedToken.Claims.(jwt.MapClaims)["iss"].(string)
+		if re.MatchString(iss) {
+			validIssuer = true
+			log.Debug("Issuer accepted: " + iss)
+			break
+		}
+	}
+
+	if !validIssuer {
+		log.Error("JWT validate: Invalid issuer")
+		return nil, fmt.Errorf("invalid issuer")
+	}
+
+	return parsedToken, nil
+}
+
+func getUserNameFromToken(jwttoken *jwt.Token) string {
+	if val, ok := jwttoken.Claims.(jwt.MapClaims)["upn"]; ok {
+		return val.(string)
+	}
+	if val, ok := jwttoken.Claims.(jwt.MapClaims)["unique_name"]; ok {
+		return val.(string)
+	}
+	return jwttoken.Claims.(jwt.MapClaims)["preferred_username"].(string)
+}
+
+func getClaimValue(jwttoken *jwt.Token, claimName string) (string, error) {
+	if val, ok := jwttoken.Claims.(jwt.MapClaims)[claimName]; ok {
+		return val.(string), nil
+	} else {
+		return "", fmt.Errorf("claim '%s' not found", claimName)
+	}
+}
+
+func getIdentity(payload *jwt.Token) (*model.Identity, error) {
+	identity := &model.Identity{}
+	identity, err := populateName(identity, payload)
+	if err != nil {
+		return nil, err
+	}
+	identity = populateUpn(identity, payload)
+	identity, err = populateTenant(identity, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func populateName(identity *model.Identity, payload *jwt.Token) (*model.Identity, error) {
+	name, err := getClaimValue(payload, "name")
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"name": name,
+	}).Info("User Full Name in token")
+	identity.Name = name
+
+	return identity, nil
+}
+
+func populateUpn(identity *model.Identity, payload *jwt.Token) *model.Identity {
+	upn := getUserNameFromToken(payload)
+	log.WithFields(log.Fields{
+		"upn": upn,
+	}).Info("User found in token")
+	identity.Upn = upn
+
+	return identity
+}
+
+func populateTenant(identity *model.Identity, payload *jwt.Token) (*model.Identity, error) {
+	tenant, err := getClaimValue(payload, "tid")
+
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"tenant": tenant,
+	}).Info("Found tenant to user")
+	identity.Tenant = tenant
+
+	return identity, nil
+}
@@ -0,0 +1,306 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const oidcDiscoveryPath = "/.well-known/openid-configuration"
+
+var providerNameRegex = regexp.MustCompile("^[a-z][a-z0-9-]{1,31}$")
+
+type discoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	JwksUri                          string   `json:"jwks_uri"`
+	EndSessionEndpoint               string   `json:"end_session_endpoint"`
+	ResponseModesSupported           []string `json:"response_modes_supported"`
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Provider is generic OpenID Connect provider configured from issuer's discovery document
+type Provider struct {
+	cfg         utils.OidcProvider
+	callbackUrl string
+	mu          sync.Mutex
+	discovery   *discoveryDocument
+	oauthConfig *oauth2.Config
+	keys        *jwk.AutoRefresh
+}
+
+func New(cfg *utils.Config, c utils.OidcProvider) *Provider {
+	if !providerNameRegex.MatchString(c.Name) {
+		log.Panic("Invalid OIDC provider name: ", c.Name)
+	}
+	if c.Issuer == "" || c.ClientId == "" {
+		log.Panic("OIDC provider requires issuer and clientid: ", c.Name)
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "email", "profile"}
+	}
+	if c.UpnClaim == "" {
+		c.UpnClaim = "email"
+	}
+	if c.NameClaim == "" {
+		c.NameClaim = "name"
+	}
+	if c.DisplayName == "" {
+		c.DisplayName = c.Name
+	}
+	return &Provider{
+		cfg:         c,
+		callbackUrl: cfg.Server.Uri + "/callback/" + c.Name,
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) DisplayName() string {
+	return p.cfg.DisplayName
+}
+
+func (p *Provider) GetAuthorizeUrl(login *oauthclient.LoginRequest, params *model.Params) (string, error) {
+	if err := p.configure(); err != nil {
+		return "", err
+	}
+
+	opts := append(login.AuthCodeOptions(), oauth2.SetAuthURLParam("prompt", "select_account"))
+	if utils.Contains(p.discovery.ResponseModesSupported, "form_post") {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", "form_post"))
+	}
+	returnUrl := p.oauthConfig.AuthCodeURL(login.State, opts...)
+
+	log.Debug("URL prepared to redirect: " + returnUrl)
+	return returnUrl, nil
+}
+
+func (p *Provider) HandleCallback(login *oauthclient.LoginRequest, w http.ResponseWriter, request *http.Request) (*model.Identity, error) {
+	if err := p.configure(); err != nil {
+		return nil, err
+	}
+
+	if errCode := request.FormValue("error"); errCode != "" {
+		log.Error("OIDC provider ", p.cfg.Name, " returned error: ", errCode, " ", request.FormValue("error_description"))
+		return nil, fmt.Errorf("provider error: %s", errCode)
+	}
+
+	code := request.FormValue("code")
+	tokenResponse, err := oauthclient.ExchangeCode(code, p.oauthConfig, login)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := oauthclient.ExtractIdToken(tokenResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.validate(idToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := login.VerifyNonce(claims["nonce"]); err != nil {
+		return nil, err
+	}
+
+	return p.identity(claims)
+}
+
+// IsIssuer returns true for issuer of the provider
+func (p *Provider) IsIssuer(issuer string) bool {
+	return issuer == p.cfg.Issuer
+}
+
+// ValidateIdToken returns user of id_token issued by the provider to this server
+func (p *Provider) ValidateIdToken(idToken string) (*model.Identity, error) {
+	if err := p.configure(); err != nil {
+		return nil, err
+	}
+	claims, err := p.validate(idToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.identity(claims)
+}
+
+// GetLogoutUrl returns end session endpoint of the provider when it is advertised in discovery document
+func (p *Provider) GetLogoutUrl(postLogoutRedirectUri string) (string, error) {
+	if err := p.configure(); err != nil {
+		return "", err
+	}
+	if p.discovery.EndSessionEndpoint == "" {
+		return "", oauthclient.ErrLogoutNotSupported
+	}
+	query := map[string]string{"client_id": p.cfg.ClientId}
+	if postLogoutRedirectUri != "" {
+		query["post_logout_redirect_uri"] = postLogoutRedirectUri
+	}
+	return utils.AddQueryParams(p.discovery.EndSessionEndpoint, query)
+}
+
+// configure lazily downloads discovery document, so unavailable provider does not block service start
+func (p *Provider) configure() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return nil
+	}
+
+	discoveryUrl := strings.TrimSuffix(p.cfg.Issuer, "/") + oidcDiscoveryPath
+	resp, err := resty.New().
+		SetTimeout(10*time.Second).
+		R().
+		SetHeader("Accept", "application/json").
+		Get(discoveryUrl)
+	if err != nil {
+		log.Error("Unable to download OIDC discovery document: ", err)
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		log.WithFields(log.Fields{
+			"url":        discoveryUrl,
+			"statusCode": resp.StatusCode(),
+		}).Error("Unexpected response when downloading OIDC discovery document")
+		return errors.New("unexpected response from OIDC discovery endpoint")
+	}
+	discovery := &discoveryDocument{}
+	if err := json.Unmarshal(resp.Body(), discovery); err != nil {
+		log.Error("Unable to parse OIDC discovery document: ", err)
+		return err
+	}
+	if discovery.Issuer != p.cfg.Issuer {
+		log.WithFields(log.Fields{
+			"expected": p.cfg.Issuer,
+			"received": discovery.Issuer,
+		}).Error("OIDC discovery document issuer mismatch")
+		return errors.New("OIDC discovery issuer mismatch")
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksUri == "" {
+		return errors.New("OIDC discovery document is incomplete")
+	}
+
+	keys := jwk.NewAutoRefresh(context.Background())
+	keys.Configure(discovery.JwksUri, jwk.WithMinRefreshInterval(15*time.Minute))
+	if _, err := keys.Refresh(context.Background(), discovery.JwksUri); err != nil {
+		log.Error("Unable to download OIDC JWKS: ", err)
+		return err
+	}
+
+	p.oauthConfig = &oauth2.Config{
+		RedirectURL:  p.callbackUrl,
+		ClientID:     p.cfg.ClientId,
+		ClientSecret: p.cfg.ClientSecret,
+		Scopes:       p.cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}
+	p.keys = keys
+	p.discovery = discovery
+	log.Info("OIDC provider configured: ", p.cfg.Name, " (", discovery.Issuer, ")")
+	return nil
+}
+
+func (p *Provider) getKey(token *jwt.Token) (interface{}, error) {
+	algs := p.discovery.IdTokenSigningAlgValuesSupported
+	if len(algs) == 0 {
+		algs = []string{"RS256"}
+	}
+	if !utils.Contains(algs, token.Method.Alg()) {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	set, err := p.keys.Fetch(context.Background(), p.discovery.JwksUri)
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := token.Header["kid"].(string)
+	var key jwk.Key
+	if kid != "" {
+		var ok bool
+		if key, ok = set.LookupKeyID(kid); !ok {
+			// key could be rotated, force refresh of key set
+			if set, err = p.keys.Refresh(context.Background(), p.discovery.JwksUri); err != nil {
+				return nil, err
+			}
+			if key, ok = set.LookupKeyID(kid); !ok {
+				return nil, fmt.Errorf("key not found")
+			}
+		}
+	} else if set.Len() == 1 {
+		key, _ = set.Get(0)
+	} else {
+		return nil, fmt.Errorf("kid header not found")
+	}
+
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return nil, fmt.Errorf("could not parse pubkey")
+	}
+	return raw, nil
+}
+
+func (p *Provider) validate(idToken string) (jwt.MapClaims, error) {
+	parsedToken, err := jwt.Parse(idToken, p.getKey)
+	if err != nil {
+		log.Error("JWT: Invalid token: ", err)
+		return nil, err
+	}
+
+	claims := parsedToken.Claims.(jwt.MapClaims)
+	if !claims.VerifyAudience(p.cfg.ClientId, true) {
+		log.Error("JWT validate: Invalid audience")
+		return nil, fmt.Errorf("invalid audience")
+	}
+	if !claims.VerifyIssuer(p.discovery.Issuer, true) {
+		log.Error("JWT validate: Invalid issuer")
+		return nil, fmt.Errorf("invalid issuer")
+	}
+	return claims, nil
+}
+
+func (p *Provider) identity(claims jwt.MapClaims) (*model.Identity, error) {
+	upn, ok := claims[p.cfg.UpnClaim].(string)
+	if !ok || upn == "" {
+		log.Error("claim '", p.cfg.UpnClaim, "' not found in OIDC token")
+		return nil, fmt.Errorf("claim '%s' not found", p.cfg.UpnClaim)
+	}
+	// do not trust unverified e-mails when e-mail is used as user identity
+	if p.cfg.UpnClaim == "email" {
+		if verified, ok := claims["email_verified"].(bool); ok && !verified {
+			log.Error("e-mail in OIDC token is not verified: ", upn)
+			return nil, fmt.Errorf("email is not verified")
+		}
+	}
+	log.WithFields(log.Fields{
+		"upn":      upn,
+		"provider": p.cfg.Name,
+	}).Info("User found in token")
+	identity := &model.Identity{Upn: upn}
+
+	if name, ok := claims[p.cfg.NameClaim].(string); ok {
+		identity.Name = name
+	}
+
+	return identity, nil
+}
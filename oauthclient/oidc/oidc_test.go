@@ -0,0 +1,196 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+const (
+	testClientId = "shieldoo"
+	testKid      = "upstream-key"
+)
+
+// testIssuer is upstream provider serving discovery document and JWKS with one RSA key
+type testIssuer struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	discovery discoveryDocument
+}
+
+func newTestIssuer(t *testing.T, modify func(discovery *discoveryDocument)) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := jwk.New(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := public.Set(jwk.KeyIDKey, testKid); err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	set.Add(public)
+
+	issuer := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidcDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(issuer.discovery)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(set)
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	issuer.discovery = discoveryDocument{
+		Issuer:                issuer.server.URL,
+		AuthorizationEndpoint: issuer.server.URL + "/authorize",
+		TokenEndpoint:         issuer.server.URL + "/token",
+		JwksUri:               issuer.server.URL + "/jwks",
+	}
+	if modify != nil {
+		modify(&issuer.discovery)
+	}
+	return issuer
+}
+
+func (i *testIssuer) provider(upnClaim string) *Provider {
+	cfg := &utils.Config{}
+	cfg.Server.Uri = "https://oauth.example.com"
+	return New(cfg, utils.OidcProvider{Name: "upstream", Issuer: i.server.URL, ClientId: testClientId, UpnClaim: upnClaim})
+}
+
+// claims returns valid id_token claims of the issuer
+func (i *testIssuer) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            i.server.URL,
+		"aud":            testClientId,
+		"sub":            "1234",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"name":           "User",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func (i *testIssuer) sign(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(discovery *discoveryDocument)
+		wantErr bool
+	}{
+		{name: "valid"},
+		{name: "issuer mismatch", modify: func(d *discoveryDocument) { d.Issuer = "https://evil.example.com" }, wantErr: true},
+		{name: "missing authorization endpoint", modify: func(d *discoveryDocument) { d.AuthorizationEndpoint = "" }, wantErr: true},
+		{name: "missing token endpoint", modify: func(d *discoveryDocument) { d.TokenEndpoint = "" }, wantErr: true},
+		{name: "missing jwks uri", modify: func(d *discoveryDocument) { d.JwksUri = "" }, wantErr: true},
+		{name: "unavailable jwks", modify: func(d *discoveryDocument) { d.JwksUri += "/missing" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestIssuer(t, tt.modify).provider("")
+			err := p.configure()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && p.oauthConfig.Endpoint.TokenURL == "" {
+				t.Fatal("token endpoint is not configured")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	issuer := newTestIssuer(t, nil)
+	p := issuer.provider("")
+	if err := p.configure(); err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := func(name string, value interface{}) jwt.MapClaims {
+		claims := issuer.claims()
+		claims[name] = value
+		return claims
+	}
+	hs256 := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.claims())
+	hs256.Header["kid"] = testKid
+	hs256Token, err := hs256.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: issuer.sign(t, issuer.claims(), issuer.key, testKid)},
+		{name: "wrong audience", token: issuer.sign(t, modified("aud", "another-client"), issuer.key, testKid), wantErr: true},
+		{name: "wrong issuer", token: issuer.sign(t, modified("iss", "https://evil.example.com"), issuer.key, testKid), wantErr: true},
+		{name: "expired", token: issuer.sign(t, modified("exp", time.Now().Add(-time.Hour).Unix()), issuer.key, testKid), wantErr: true},
+		{name: "unknown kid", token: issuer.sign(t, issuer.claims(), issuer.key, "rotated-key"), wantErr: true},
+		{name: "signed by another key", token: issuer.sign(t, issuer.claims(), otherKey, testKid), wantErr: true},
+		{name: "algorithm not advertised", token: hs256Token, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.validate(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	issuer := newTestIssuer(t, nil)
+	tests := []struct {
+		name     string
+		upnClaim string
+		claims   jwt.MapClaims
+		wantUpn  string
+		wantErr  bool
+	}{
+		{name: "email", claims: jwt.MapClaims{"email": "user@example.com", "email_verified": true, "name": "User"}, wantUpn: "user@example.com"},
+		{name: "email without verification flag", claims: jwt.MapClaims{"email": "user@example.com"}, wantUpn: "user@example.com"},
+		{name: "unverified email", claims: jwt.MapClaims{"email": "user@example.com", "email_verified": false}, wantErr: true},
+		{name: "missing email", claims: jwt.MapClaims{"name": "User"}, wantErr: true},
+		{name: "configured claim", upnClaim: "preferred_username", claims: jwt.MapClaims{"preferred_username": "user", "email_verified": false}, wantUpn: "user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := issuer.provider(tt.upnClaim).identity(tt.claims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && identity.Upn != tt.wantUpn {
+				t.Fatalf("upn = %s, want %s", identity.Upn, tt.wantUpn)
+			}
+		})
+	}
+}
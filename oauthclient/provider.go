@@ -0,0 +1,161 @@
+package oauthclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrUnknownProvider    = errors.New("unknown provider")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrLogoutNotSupported = errors.New("logout is not supported by provider")
+)
+
+// Provider is an upstream identity provider used to authenticate users.
+// Providers live in their own packages and are registered during start using Register.
+type Provider interface {
+	// Name identifies provider in login form, callback URL (/callback/<name>) and issued tokens
+	Name() string
+	// DisplayName is shown on the login button
+	DisplayName() string
+	// GetAuthorizeUrl returns URL where user is redirected to sign in, login.State has to be sent back to callback,
+	// OAuth providers send PKCE challenge and nonce from login.AuthCodeOptions
+	GetAuthorizeUrl(login *LoginRequest, params *model.Params) (string, error)
+	// HandleCallback validates provider response and returns authenticated user,
+	// OAuth providers exchange code with login.CodeVerifier and verify id_token nonce using login.VerifyNonce
+	HandleCallback(login *LoginRequest, w http.ResponseWriter, r *http.Request) (*model.Identity, error)
+}
+
+// IdTokenValidator is implemented by providers able to validate id_token they issued to this server,
+// such id_token can be exchanged for access token by token exchange grant
+type IdTokenValidator interface {
+	// IsIssuer returns true when provider issues id_tokens with the issuer
+	IsIssuer(issuer string) bool
+	// ValidateIdToken checks signature, expiry and audience of id_token and returns authenticated user
+	ValidateIdToken(idToken string) (*model.Identity, error)
+}
+
+// LogoutProvider is implemented by providers supporting RP-initiated logout
+type LogoutProvider interface {
+	// GetLogoutUrl returns URL where user is redirected to sign out of the provider, provider redirects user
+	// back to postLogoutRedirectUri when it is registered at the provider
+	GetLogoutUrl(postLogoutRedirectUri string) (string, error)
+}
+
+var providers = map[string]Provider{}
+var providerNames []string
+
+// Register adds provider to the registry, providers are listed on login page in registration order
+func Register(p Provider) {
+	if _, ok := providers[p.Name()]; ok {
+		log.Panic("Duplicate provider name: ", p.Name())
+	}
+	providers[p.Name()] = p
+	providerNames = append(providerNames, p.Name())
+	log.Info("Provider registered: ", p.Name())
+}
+
+func GetProvider(name string) (Provider, bool) {
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Providers returns registered providers in registration order
+func Providers() []Provider {
+	ret := make([]Provider, 0, len(providerNames))
+	for _, name := range providerNames {
+		ret = append(ret, providers[name])
+	}
+	return ret
+}
+
+// ValidateIdToken finds provider by issuer of upstream id_token, lets it validate the token and returns
+// authenticated user and name of the provider
+func ValidateIdToken(idToken string) (*model.Identity, string, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, claims); err != nil {
+		return nil, "", err
+	}
+	issuer, _ := claims["iss"].(string)
+	for _, name := range providerNames {
+		validator, ok := providers[name].(IdTokenValidator)
+		if !ok || !validator.IsIssuer(issuer) {
+			continue
+		}
+		identity, err := validator.ValidateIdToken(idToken)
+		if err != nil {
+			return nil, "", err
+		}
+		return identity, name, nil
+	}
+	log.Warn("No provider accepts id_token issuer: ", issuer)
+	return nil, "", ErrUnknownProvider
+}
+
+// GetLogoutUrl returns sign out URL of provider, ErrLogoutNotSupported is returned when provider does not support logout
+func GetLogoutUrl(name string, postLogoutRedirectUri string) (string, error) {
+	p, ok := GetProvider(name)
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	logoutProvider, ok := p.(LogoutProvider)
+	if !ok {
+		return "", ErrLogoutNotSupported
+	}
+	return logoutProvider.GetLogoutUrl(postLogoutRedirectUri)
+}
+
+// GetAuthorizeUrl seals params into state bound to the browser by cookie and returns provider's sign in URL
+func GetAuthorizeUrl(w http.ResponseWriter, name string, params *model.Params) (string, error) {
+	p, ok := GetProvider(name)
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	params.Provider = name
+	login := newLoginRequest()
+	state, err := sealState(w, params, login)
+	if err != nil {
+		return "", err
+	}
+	login.State = state
+	return p.GetAuthorizeUrl(login, params)
+}
+
+// HandleCallback lets provider authenticate the user and returns params from state populated with user identity
+func HandleCallback(name string, w http.ResponseWriter, request *http.Request) (*model.Params, error) {
+	p, ok := GetProvider(name)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	state := request.FormValue("state")
+	envelope, err := openState(request, state)
+	if err != nil {
+		log.Warn("Callback rejected: ", err)
+		return nil, err
+	}
+	params := envelope.Params
+	if params.Provider != name {
+		log.Error("State was issued for provider ", params.Provider, ", callback received by ", name)
+		return nil, fmt.Errorf("provider mismatch")
+	}
+
+	if err := consumeState(w, envelope); err != nil {
+		log.Warn("Callback rejected: ", err)
+		return nil, err
+	}
+	identity, err := p.HandleCallback(envelope.loginRequest(state), w, request)
+	if err != nil {
+		return nil, err
+	}
+
+	params.Upn = identity.Upn
+	params.Name = identity.Name
+	params.Tenant = identity.Tenant
+	return params, nil
+}
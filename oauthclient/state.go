@@ -0,0 +1,172 @@
+package oauthclient
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	stateCookieName      = "shdoauth_state"
+	stateAdditionalData  = "shieldoo-oauth-state"
+	defaultStateDuration = 600
+	minStateSecretLength = 32
+
+	// used state nonces are kept in storage until the state expires, so state can not be replayed at another instance
+	bucketUsedStates = "used_oauth_states"
+)
+
+var (
+	ErrInvalidState = errors.New("state is invalid")
+	ErrExpiredState = errors.New("state has expired")
+	ErrReusedState  = errors.New("state was already used")
+)
+
+// stateEnvelope is sealed into opaque state parameter sent to the provider
+type stateEnvelope struct {
+	Params       *model.Params `json:"p"`
+	Nonce        string        `json:"n"`
+	ExpiryAt     int64         `json:"e"`
+	IdTokenNonce string        `json:"in"`
+	CodeVerifier string        `json:"cv"`
+}
+
+var stateAead cipher.AEAD
+var stateDuration time.Duration
+
+func initState(cfg *utils.Config) {
+	secret := []byte(cfg.OAuthClient.StateSecret)
+	if len(secret) == 0 {
+		log.Warn("oauthclient.state_secret is not configured, random key is used - logins will fail when running multiple instances")
+		secret = utils.GenerateRandomBytes(32)
+	} else if !isStrongSecret(secret) {
+		log.Panic("oauthclient.state_secret has to be at least ", minStateSecretLength, " bytes long and can not repeat single character")
+	}
+	key := sha256.Sum256(append([]byte(stateAdditionalData+":"), secret...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		log.Panic("Unable initialize state encryption: ", err)
+	}
+	stateAead, err = cipher.NewGCM(block)
+	if err != nil {
+		log.Panic("Unable initialize state encryption: ", err)
+	}
+
+	stateDuration = time.Duration(cfg.OAuthClient.StateDuration) * time.Second
+	if stateDuration <= 0 {
+		stateDuration = defaultStateDuration * time.Second
+	}
+}
+
+// isStrongSecret rejects short secrets and placeholders made of one repeated character
+func isStrongSecret(secret []byte) bool {
+	if len(secret) < minStateSecretLength {
+		return false
+	}
+	for _, b := range secret {
+		if b != secret[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// sealState encrypts and authenticates params and login secrets together with nonce bound to browser cookie
+func sealState(w http.ResponseWriter, params *model.Params, login *LoginRequest) (string, error) {
+	envelope := &stateEnvelope{
+		Params:       params,
+		Nonce:        utils.GenerateRandomString(32),
+		ExpiryAt:     time.Now().Add(stateDuration).Unix(),
+		IdTokenNonce: login.Nonce,
+		CodeVerifier: login.CodeVerifier,
+	}
+	plaintext, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	nonce := utils.GenerateRandomBytes(stateAead.NonceSize())
+	if nonce == nil {
+		return "", errors.New("unable to generate random nonce")
+	}
+	sealed := stateAead.Seal(nonce, nonce, plaintext, []byte(stateAdditionalData))
+
+	http.SetCookie(w, stateCookie(envelope.Nonce, int(stateDuration.Seconds())))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openState decrypts state and checks it was issued to the same browser and is not expired or already used
+func openState(r *http.Request, state string) (*stateEnvelope, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(state)
+	if err != nil || len(sealed) < stateAead.NonceSize() {
+		return nil, ErrInvalidState
+	}
+	nonceSize := stateAead.NonceSize()
+	plaintext, err := stateAead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(stateAdditionalData))
+	if err != nil {
+		log.Warn("State tampered or sealed with different key")
+		return nil, ErrInvalidState
+	}
+	envelope := &stateEnvelope{}
+	if err := json.Unmarshal(plaintext, envelope); err != nil || envelope.Params == nil {
+		return nil, ErrInvalidState
+	}
+	if time.Now().Unix() > envelope.ExpiryAt {
+		return nil, ErrExpiredState
+	}
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(envelope.Nonce)) != 1 {
+		log.Warn("State does not match browser cookie")
+		return nil, ErrInvalidState
+	}
+	var used bool
+	if err := storage.Get(bucketUsedStates, envelope.Nonce, &used); err == nil {
+		return nil, ErrReusedState
+	}
+	return envelope, nil
+}
+
+func (e *stateEnvelope) loginRequest(state string) *LoginRequest {
+	return &LoginRequest{State: state, Nonce: e.IdTokenNonce, CodeVerifier: e.CodeVerifier}
+}
+
+// consumeState marks state as used and removes binding cookie, so it can not be replayed, state has to be
+// consumed before code is redeemed at the provider
+func consumeState(w http.ResponseWriter, envelope *stateEnvelope) error {
+	if err := storage.Add(bucketUsedStates, envelope.Nonce, true, time.Unix(envelope.ExpiryAt, 0)); err != nil {
+		if errors.Is(err, storage.ErrExists) {
+			return ErrReusedState
+		}
+		return err
+	}
+	http.SetCookie(w, stateCookie("", -1))
+	return nil
+}
+
+func stateCookie(value string, maxAge int) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     stateCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	// providers post response cross-site (response_mode=form_post), such cookie is sent only when SameSite=None
+	if strings.HasPrefix(_cfg.Server.Uri, "https://") {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
@@ -0,0 +1,179 @@
+package oauthclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+func TestMain(m *testing.M) {
+	cfg := &utils.Config{}
+	cfg.Server.Uri = "https://oauth.example.com"
+	cfg.OAuthClient.StateSecret = "0123456789abcdef0123456789abcdef"
+	storage.Init(cfg)
+	Init(cfg)
+	os.Exit(m.Run())
+}
+
+// testLogin seals state of new login and returns it together with the binding cookie
+func testLogin(t *testing.T) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	state, err := sealState(w, &model.Params{Audience: "localhost", Provider: "google"}, newLoginRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != stateCookieName {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	return state, cookies[0]
+}
+
+func callbackRequest(cookie *http.Cookie) *http.Request {
+	r := httptest.NewRequest("GET", "/callback/google", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestOpenState(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, state string, cookie *http.Cookie) (string, *http.Cookie)
+		wantErr error
+	}{
+		{name: "valid"},
+		{
+			name: "tampered",
+			prepare: func(t *testing.T, state string, cookie *http.Cookie) (string, *http.Cookie) {
+				i := len(state) / 2
+				c := "A"
+				if state[i] == 'A' {
+					c = "B"
+				}
+				return state[:i] + c + state[i+1:], cookie
+			},
+			wantErr: ErrInvalidState,
+		},
+		{
+			name: "not sealed",
+			prepare: func(t *testing.T, state string, cookie *http.Cookie) (string, *http.Cookie) {
+				return "eyJhdWQiOiJsb2NhbGhvc3QifQ", cookie
+			},
+			wantErr: ErrInvalidState,
+		},
+		{
+			name: "missing cookie",
+			prepare: func(t *testing.T, state string, cookie *http.Cookie) (string, *http.Cookie) {
+				return state, nil
+			},
+			wantErr: ErrInvalidState,
+		},
+		{
+			name: "cookie of another login",
+			prepare: func(t *testing.T, state string, cookie *http.Cookie) (string, *http.Cookie) {
+				_, other := testLogin(t)
+				return state, other
+			},
+			wantErr: ErrInvalidState,
+		},
+		{
+			name: "state of another login",
+			prepare: func(t *testing.T, state string, cookie *http.Cookie) (string, *http.Cookie) {
+				other, _ := testLogin(t)
+				return other, cookie
+			},
+			wantErr: ErrInvalidState,
+		},
+		{
+			name: "reused",
+			prepare: func(t *testing.T, state string, cookie *http.Cookie) (string, *http.Cookie) {
+				envelope, err := openState(callbackRequest(cookie), state)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := consumeState(httptest.NewRecorder(), envelope); err != nil {
+					t.Fatal(err)
+				}
+				return state, cookie
+			},
+			wantErr: ErrReusedState,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, cookie := testLogin(t)
+			if tt.prepare != nil {
+				state, cookie = tt.prepare(t, state, cookie)
+			}
+			envelope, err := openState(callbackRequest(cookie), state)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && envelope.Params.Provider != "google" {
+				t.Fatalf("unexpected params %+v", envelope.Params)
+			}
+		})
+	}
+}
+
+func TestExpiredState(t *testing.T) {
+	duration := stateDuration
+	stateDuration = -time.Second
+	state, cookie := testLogin(t)
+	stateDuration = duration
+
+	if _, err := openState(callbackRequest(cookie), state); !errors.Is(err, ErrExpiredState) {
+		t.Fatalf("error = %v, want %v", err, ErrExpiredState)
+	}
+}
+
+func TestConsumeState(t *testing.T) {
+	state, cookie := testLogin(t)
+	envelope, err := openState(callbackRequest(cookie), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if err := consumeState(w, envelope); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("binding cookie is not removed: %v", cookies)
+	}
+	// concurrent callback with the same state opened it before it was consumed
+	if err := consumeState(httptest.NewRecorder(), envelope); !errors.Is(err, ErrReusedState) {
+		t.Fatalf("error = %v, want %v", err, ErrReusedState)
+	}
+}
+
+func TestIsStrongSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		want   bool
+	}{
+		{name: "random", secret: "3q2+7wAAAAAhIiMkJSYnKCkqKywtLi8w", want: true},
+		{name: "short", secret: "0123456789abcdef"},
+		{name: "repeated character", secret: strings.Repeat("X", 64)},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStrongSecret([]byte(tt.secret)); got != tt.want {
+				t.Fatalf("isStrongSecret(%q) = %v, want %v", tt.secret, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package oauthserver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// optionalClaims can be left out of access tokens of the audience
+var optionalClaims = []string{"name", "tenant", "provider", "roles"}
+
+// registeredClaims are claims registered for JWT (RFC 7519), token exchange (RFC 8693), JWT access tokens
+// (RFC 9068), DPoP (RFC 9449) and OpenID Connect, static claims can not use them
+var registeredClaims = []string{
+	"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "typ", "cty",
+	"act", "may_act", "scope", "client_id",
+	"auth_time", "acr", "amr", "groups", "roles", "entitlements",
+	"cnf", "azp", "nonce", "at_hash", "c_hash", "sid", "events",
+}
+
+// audienceTokens is configuration of access tokens of static audience, defaults of the server apply
+// to settings which are not set
+type audienceTokens struct {
+	duration time.Duration
+	// maker signs access tokens of the audience, server Maker is used when nil
+	maker          *KeySetMaker
+	claims         map[string]string
+	optionalClaims []string
+}
+
+// audiences are keyed by audience name, audiences without own settings are not present
+var audiences map[string]*audienceTokens
+
+func initAudiences(staticAudiences []utils.StaticAudience) error {
+	audiences = map[string]*audienceTokens{}
+	kids := map[string]bool{}
+	for _, v := range serverKeys() {
+		kids[v.keyId()] = true
+	}
+	for _, v := range staticAudiences {
+		if v.Duration == 0 && len(v.SigningKeys) == 0 && len(v.Claims) == 0 && len(v.OptionalClaims) == 0 {
+			continue
+		}
+		tokens, err := newAudienceTokens(v, kids)
+		if err != nil {
+			return fmt.Errorf("audience %s: %w", v.Name, err)
+		}
+		audiences[v.Name] = tokens
+	}
+	return nil
+}
+
+func newAudienceTokens(cfg utils.StaticAudience, kids map[string]bool) (*audienceTokens, error) {
+	if cfg.Duration < 0 {
+		return nil, errors.New("invalid duration")
+	}
+	tokens := &audienceTokens{
+		duration:       time.Second * time.Duration(cfg.Duration),
+		claims:         cfg.Claims,
+		optionalClaims: cfg.OptionalClaims,
+	}
+	for name := range cfg.Claims {
+		if utils.Contains(supportedClaims, name) {
+			return nil, errors.New("static claim overrides claim of the server " + name)
+		}
+		if utils.Contains(registeredClaims, name) {
+			return nil, errors.New("static claim uses registered claim name " + name)
+		}
+	}
+	for _, name := range cfg.OptionalClaims {
+		if !utils.Contains(optionalClaims, name) {
+			return nil, errors.New("unknown optional claim " + name)
+		}
+	}
+	if len(cfg.SigningKeys) > 0 {
+		maker, err := NewKeySetMaker(_cfg.OAuthServer.Signing.Method, cfg.SigningKeys)
+		if err != nil {
+			return nil, err
+		}
+		// tokens are verified by key selected by kid, so kid has to identify single key
+		for _, key := range maker.publishedKeys() {
+			if kids[key.keyId()] {
+				return nil, fmt.Errorf("duplicate key %s", key.keyId())
+			}
+			kids[key.keyId()] = true
+		}
+		tokens.maker = maker
+		log.WithFields(log.Fields{
+			"audience": cfg.Name,
+			"alg":      maker.Algorithm(),
+		}).Info("Access tokens of audience are signed by own key")
+	}
+	return tokens, nil
+}
+
+// audienceDuration returns lifetime of access tokens of the audience, zero when it is not configured
+func audienceDuration(audience string) time.Duration {
+	if tokens, ok := audiences[audience]; ok {
+		return tokens.duration
+	}
+	return 0
+}
+
+// audienceMaker returns Maker signing access tokens of the audience
+func audienceMaker(audience string) Maker {
+	if tokens, ok := audiences[audience]; ok && tokens.maker != nil {
+		return tokens.maker
+	}
+	return globJwtMaker
+}
+
+// applyAudience leaves out optional claims not selected for the audience and adds its static claims
+func applyAudience(payload *Payload) {
+	tokens, ok := audiences[payload.Aud]
+	if !ok {
+		return
+	}
+	if len(tokens.optionalClaims) > 0 {
+		if !utils.Contains(tokens.optionalClaims, "name") {
+			payload.Name = ""
+		}
+		if !utils.Contains(tokens.optionalClaims, "tenant") {
+			payload.Tenant = ""
+		}
+		if !utils.Contains(tokens.optionalClaims, "provider") {
+			payload.Provider = ""
+		}
+		if !utils.Contains(tokens.optionalClaims, "roles") {
+			payload.Roles = nil
+		}
+	}
+	payload.Extra = tokens.claims
+}
+
+// verifySignedToken verifies token by key selected by kid, token signed by key of an audience has to be
+// issued for the audience
+func verifySignedToken(token string) (*Payload, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(token, &Payload{})
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	kid, _ := unverified.Header["kid"].(string)
+	for name, tokens := range audiences {
+		if tokens.maker == nil || !tokens.maker.hasKey(kid) {
+			continue
+		}
+		payload, err := tokens.maker.VerifyToken(token)
+		if err != nil {
+			return nil, err
+		}
+		if payload.Aud != name {
+			return nil, fmt.Errorf("%w: token is not signed by key of its audience", ErrInvalidToken)
+		}
+		return payload, nil
+	}
+	return globJwtMaker.VerifyToken(token)
+}
+
+// audienceKeys returns signing keys of all audiences, they are published in JWKS
+func audienceKeys() []asymmetricMaker {
+	names := make([]string, 0, len(audiences))
+	for name := range audiences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var keys []asymmetricMaker
+	for _, name := range names {
+		if maker := audiences[name].maker; maker != nil {
+			keys = append(keys, maker.publishedKeys()...)
+		}
+	}
+	return keys
+}
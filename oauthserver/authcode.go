@@ -0,0 +1,130 @@
+package oauthserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketAuthorizationRequests = "authorization_requests"
+	bucketAuthorizationCodes    = "authorization_codes"
+
+	authorizationRequestDuration = 600
+	defaultCodeDuration          = 60
+
+	CodeChallengeMethodS256 = "S256"
+	ResponseTypeCode        = "code"
+)
+
+// AuthorizationRequest is validated request received at authorization endpoint, kept until user signs in
+type AuthorizationRequest struct {
+	ClientId            string `json:"client_id"`
+	RedirectUri         string `json:"redirect_uri"`
+	Scope               string `json:"scope,omitempty"`
+	State               string `json:"state,omitempty"`
+	Nonce               string `json:"nonce,omitempty"`
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+	Audience            string `json:"audience"`
+	// DPoPJkt binds authorization code to DPoP key of the client (RFC 9449 section 10)
+	DPoPJkt string `json:"dpop_jkt,omitempty"`
+}
+
+// AuthorizationCode is issued to the client after user signs in and is redeemed at token endpoint
+type AuthorizationCode struct {
+	Request     AuthorizationRequest    `json:"request"`
+	Params      model.Params            `json:"params"`
+	UserDetails *model.SysApiUserDetail `json:"user_details,omitempty"`
+	AuthTime    int64                   `json:"auth_time"`
+}
+
+func CreateAuthorizationRequest(request *AuthorizationRequest) (string, error) {
+	id := utils.GenerateRandomString(32)
+	err := storage.Put(bucketAuthorizationRequests, id, request,
+		time.Now().Add(authorizationRequestDuration*time.Second))
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func GetAuthorizationRequest(id string) (*AuthorizationRequest, error) {
+	request := &AuthorizationRequest{}
+	if err := storage.Get(bucketAuthorizationRequests, id, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// CreateAuthorizationCode finishes authorization request of signed in user and returns one-time code
+func CreateAuthorizationCode(params *model.Params, userDetails *model.SysApiUserDetail) (string, *AuthorizationRequest, error) {
+	request := &AuthorizationRequest{}
+	if err := storage.Take(bucketAuthorizationRequests, params.Request, request); err != nil {
+		return "", nil, err
+	}
+
+	code := utils.GenerateRandomString(32)
+	authCode := &AuthorizationCode{
+		Request:     *request,
+		Params:      *params,
+		UserDetails: userDetails,
+		AuthTime:    time.Now().Unix(),
+	}
+	duration := _cfg.OAuthServer.CodeDuration
+	if duration <= 0 {
+		duration = defaultCodeDuration
+	}
+	err := storage.Put(bucketAuthorizationCodes, hashValue(code), authCode,
+		time.Now().Add(time.Duration(duration)*time.Second))
+	if err != nil {
+		return "", nil, err
+	}
+	return code, request, nil
+}
+
+// RedeemAuthorizationCode validates code against the client, redirect URI and PKCE verifier, code can be redeemed once
+func RedeemAuthorizationCode(code string, client *utils.Client, redirectUri string, codeVerifier string) (*AuthorizationCode, error) {
+	authCode := &AuthorizationCode{}
+	if err := storage.Take(bucketAuthorizationCodes, hashValue(code), authCode); err != nil {
+		log.Warn("Unknown, expired or already used authorization code")
+		return nil, ErrInvalidGrant("invalid authorization code")
+	}
+	if authCode.Request.ClientId != client.ClientId {
+		log.Warn("Authorization code issued to another client: ", authCode.Request.ClientId, " used by: ", client.ClientId)
+		return nil, ErrInvalidGrant("invalid authorization code")
+	}
+	if authCode.Request.RedirectUri != redirectUri {
+		return nil, ErrInvalidGrant("redirect_uri does not match")
+	}
+	if authCode.Request.CodeChallenge != "" {
+		if codeVerifier == "" {
+			return nil, ErrInvalidGrant("missing code_verifier")
+		}
+		if !verifyCodeChallenge(authCode.Request.CodeChallenge, codeVerifier) {
+			return nil, ErrInvalidGrant("invalid code_verifier")
+		}
+	} else if codeVerifier != "" {
+		return nil, ErrInvalidGrant("code_verifier sent without code_challenge")
+	}
+	return authCode, nil
+}
+
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// hashValue is used as storage key for secrets, so storage content can not be used to redeem them
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,123 @@
+package oauthserver
+
+import (
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+const (
+	testRedirectUri = "https://app.example.com/callback"
+	// RFC 7636 appendix B
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+// issueTestCode stores authorization request and returns code issued for it after user signed in
+func issueTestCode(t *testing.T, request *AuthorizationRequest) string {
+	t.Helper()
+	id, err := CreateAuthorizationRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := CreateAuthorizationCode(&model.Params{Request: id, Upn: "user@example.com"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		verifier  string
+		want      bool
+	}{
+		{name: "matching", challenge: testCodeChallenge, verifier: testCodeVerifier, want: true},
+		{name: "wrong verifier", challenge: testCodeChallenge, verifier: testCodeVerifier + "x"},
+		{name: "plain method", challenge: testCodeVerifier, verifier: testCodeVerifier},
+		{name: "empty verifier", challenge: testCodeChallenge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCodeChallenge(tt.challenge, tt.verifier); got != tt.want {
+				t.Fatalf("verifyCodeChallenge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedeemAuthorizationCode(t *testing.T) {
+	client := &utils.Client{ClientId: "app"}
+	withPkce := &AuthorizationRequest{ClientId: "app", RedirectUri: testRedirectUri,
+		CodeChallenge: testCodeChallenge, CodeChallengeMethod: CodeChallengeMethodS256}
+	withoutPkce := &AuthorizationRequest{ClientId: "app", RedirectUri: testRedirectUri}
+
+	tests := []struct {
+		name         string
+		request      *AuthorizationRequest
+		client       *utils.Client
+		redirectUri  string
+		codeVerifier string
+		wantErr      bool
+	}{
+		{name: "valid", request: withPkce, client: client, redirectUri: testRedirectUri, codeVerifier: testCodeVerifier},
+		{name: "valid without PKCE", request: withoutPkce, client: client, redirectUri: testRedirectUri},
+		{name: "wrong code_verifier", request: withPkce, client: client, redirectUri: testRedirectUri, codeVerifier: "wrong-verifier", wantErr: true},
+		{name: "missing code_verifier", request: withPkce, client: client, redirectUri: testRedirectUri, wantErr: true},
+		{name: "code_verifier without challenge", request: withoutPkce, client: client, redirectUri: testRedirectUri, codeVerifier: testCodeVerifier, wantErr: true},
+		{name: "redirect_uri mismatch", request: withPkce, client: client, redirectUri: testRedirectUri + "/other", codeVerifier: testCodeVerifier, wantErr: true},
+		{name: "missing redirect_uri", request: withPkce, client: client, codeVerifier: testCodeVerifier, wantErr: true},
+		{name: "another client", request: withPkce, client: &utils.Client{ClientId: "other"}, redirectUri: testRedirectUri, codeVerifier: testCodeVerifier, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := issueTestCode(t, tt.request)
+			authCode, err := RedeemAuthorizationCode(code, tt.client, tt.redirectUri, tt.codeVerifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && authCode.Params.Upn != "user@example.com" {
+				t.Fatalf("unexpected params %+v", authCode.Params)
+			}
+		})
+	}
+}
+
+func TestAuthorizationCodeSingleUse(t *testing.T) {
+	client := &utils.Client{ClientId: "app"}
+	request := &AuthorizationRequest{ClientId: "app", RedirectUri: testRedirectUri}
+
+	tests := []struct {
+		name        string
+		redirectUri string
+	}{
+		{name: "redeemed code", redirectUri: testRedirectUri},
+		// failed attempt consumes the code, so it can not be guessed
+		{name: "code of failed redemption", redirectUri: testRedirectUri + "/other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := issueTestCode(t, request)
+			_, _ = RedeemAuthorizationCode(code, client, tt.redirectUri, "")
+			if _, err := RedeemAuthorizationCode(code, client, testRedirectUri, ""); err == nil {
+				t.Fatal("code was redeemed twice")
+			}
+		})
+	}
+
+	t.Run("authorization request", func(t *testing.T) {
+		id, err := CreateAuthorizationRequest(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := CreateAuthorizationCode(&model.Params{Request: id}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := CreateAuthorizationCode(&model.Params{Request: id}, nil); err == nil {
+			t.Fatal("second code was issued for the same authorization request")
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package oauthserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketBackchannelLogouts = "backchannel_logouts"
+	bucketBackchannelClaims  = "backchannel_logout_claims"
+
+	// BackchannelLogoutEvent is event of logout token (OpenID Connect Back-Channel Logout 1.0 section 2.4)
+	BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+
+	logoutTokenDuration        = 120
+	backchannelTimeout         = 10
+	backchannelMaxAttempts     = 5
+	backchannelRetryDelay      = 10
+	backchannelDeliveryPeriod  = 5
+	backchannelDeliveryHistory = 7 * 24 * 3600
+)
+
+// BackchannelLogout is delivery of logout token to back-channel logout URI of the client, deliveries are kept
+// as delivery log after they are delivered or failed
+type BackchannelLogout struct {
+	Id            string `json:"id"`
+	ClientId      string `json:"client_id"`
+	Uri           string `json:"uri"`
+	Upn           string `json:"upn"`
+	SessionId     string `json:"sid"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	StatusCode    int    `json:"status_code,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	NextAttemptAt int64  `json:"next_attempt_at,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+	UpdatedAt     int64  `json:"updated_at"`
+}
+
+// scheduleBackchannelLogouts queues logout token for every client which got tokens in the session and has
+// back-channel logout URI, tokens are delivered in background
+func scheduleBackchannelLogouts(upn string, sessionId string) error {
+	clients := &sessionClients{}
+	if err := storage.Get(bucketSessionClients, sessionId, clients); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, clientId := range clients.ClientIds {
+		v := FindClient(clientId)
+		if v == nil || v.BackchannelLogoutUri == "" || v.Pending {
+			continue
+		}
+		delivery := &BackchannelLogout{
+			Id:            utils.GenerateRandomString(16),
+			ClientId:      v.ClientId,
+			Uri:           v.BackchannelLogoutUri,
+			Upn:           upn,
+			SessionId:     sessionId,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := putBackchannelLogout(delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListBackchannelLogouts returns delivery log, newest deliveries first, all clients when client id is empty
+func ListBackchannelLogouts(clientId string) ([]BackchannelLogout, error) {
+	deliveries := []BackchannelLogout{}
+	err := storage.List(bucketBackchannelLogouts, func(key string, data []byte) error {
+		delivery := BackchannelLogout{}
+		if err := json.Unmarshal(data, &delivery); err != nil {
+			return err
+		}
+		if clientId == "" || delivery.ClientId == clientId {
+			deliveries = append(deliveries, delivery)
+		}
+		return nil
+	})
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt > deliveries[j].CreatedAt })
+	return deliveries, err
+}
+
+func backchannelLogoutLoop() {
+	for range time.Tick(backchannelDeliveryPeriod * time.Second) {
+		if err := deliverBackchannelLogouts(); err != nil {
+			log.Error("Unable to deliver back-channel logouts: ", err)
+		}
+	}
+}
+
+// deliverBackchannelLogouts sends due logout tokens, attempt is claimed so other instances do not send it too,
+// delivery stays in storage while it is sent and is retried when the instance stops before its result is stored
+func deliverBackchannelLogouts() error {
+	now := time.Now().Unix()
+	var due []string
+	err := storage.List(bucketBackchannelLogouts, func(key string, data []byte) error {
+		delivery := &BackchannelLogout{}
+		if err := json.Unmarshal(data, delivery); err != nil {
+			return err
+		}
+		if delivery.Status == DeliveryPending && delivery.NextAttemptAt <= now {
+			due = append(due, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range due {
+		delivery := &BackchannelLogout{}
+		if err := storage.Get(bucketBackchannelLogouts, key, delivery); err != nil || delivery.Status != DeliveryPending {
+			continue
+		}
+		claim := fmt.Sprintf("%s:%d", delivery.Id, delivery.Attempts)
+		if err := storage.Add(bucketBackchannelClaims, claim, true, time.Now().Add(2*backchannelTimeout*time.Second)); err != nil {
+			if !errors.Is(err, storage.ErrExists) {
+				return err
+			}
+			continue
+		}
+		delivery.Attempts++
+		delivery.UpdatedAt = time.Now().Unix()
+		delivery.NextAttemptAt = time.Now().Add(backchannelRetryAfter(delivery.Attempts)).Unix()
+		if err := putBackchannelLogout(delivery); err != nil {
+			return err
+		}
+		deliverBackchannelLogout(delivery)
+		if err := putBackchannelLogout(delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backchannelRetryAfter is delay after attempt, delay is doubled with every attempt
+func backchannelRetryAfter(attempts int) time.Duration {
+	return time.Duration(backchannelRetryDelay<<(attempts-1)) * time.Second
+}
+
+// deliverBackchannelLogout posts logout token to the client, failed delivery is retried with doubled delay
+func deliverBackchannelLogout(delivery *BackchannelLogout) {
+	delivery.UpdatedAt = time.Now().Unix()
+	err := postLogoutToken(delivery)
+	fields := log.Fields{
+		"clientId": delivery.ClientId,
+		"sid":      delivery.SessionId,
+		"attempt":  delivery.Attempts,
+	}
+	if err == nil {
+		delivery.Status = DeliveryDelivered
+		delivery.LastError = ""
+		delivery.NextAttemptAt = 0
+		log.WithFields(fields).Info("Back-channel logout delivered")
+		return
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= backchannelMaxAttempts {
+		delivery.Status = DeliveryFailed
+		delivery.NextAttemptAt = 0
+		log.WithFields(fields).Error("Back-channel logout failed: ", err)
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(backchannelRetryAfter(delivery.Attempts)).Unix()
+	log.WithFields(fields).Warn("Back-channel logout will be retried: ", err)
+}
+
+func postLogoutToken(delivery *BackchannelLogout) error {
+	client := FindClient(delivery.ClientId)
+	if client == nil {
+		return ErrClientNotFound
+	}
+	token, err := createLogoutToken(client, delivery)
+	if err != nil {
+		return err
+	}
+	resp, err := resty.New().
+		SetTimeout(backchannelTimeout * time.Second).
+		R().
+		SetFormData(map[string]string{"logout_token": token}).
+		Post(delivery.Uri)
+	if err != nil {
+		return err
+	}
+	delivery.StatusCode = resp.StatusCode()
+	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusNoContent {
+		return fmt.Errorf("unexpected response %s", resp.Status())
+	}
+	return nil
+}
+
+// createLogoutToken signs logout token for the client with active key, audience is the client
+// (OpenID Connect Back-Channel Logout 1.0 section 2.4)
+func createLogoutToken(client *utils.Client, delivery *BackchannelLogout) (string, error) {
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	payload := &Payload{
+		Issuer:    _cfg.OAuthServer.Issuer,
+		Id:        tokenID,
+		Subject:   delivery.Upn,
+		Upn:       delivery.Upn,
+		Aud:       client.ClientId,
+		IssueAt:   jwt.NewNumericDate(time.Now()),
+		ExpiryAt:  jwt.NewNumericDate(time.Now().Add(logoutTokenDuration * time.Second)),
+		SessionId: delivery.SessionId,
+		Events:    map[string]interface{}{BackchannelLogoutEvent: struct{}{}},
+	}
+	return globJwtMaker.SignPayload(payload)
+}
+
+// putBackchannelLogout stores delivery, delivered and failed deliveries are kept as delivery log
+func putBackchannelLogout(delivery *BackchannelLogout) error {
+	expiryAt := time.Unix(delivery.UpdatedAt, 0).Add(backchannelDeliveryHistory * time.Second)
+	return storage.Put(bucketBackchannelLogouts, delivery.Id, delivery, expiryAt)
+}
@@ -0,0 +1,276 @@
+package oauthserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	bucketClients = "clients"
+
+	ClientAuthMethodSecretBasic = "client_secret_basic"
+	ClientAuthMethodSecretPost  = "client_secret_post"
+	ClientAuthMethodNone        = "none"
+)
+
+var clientIdValidRegex = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9-_.]{2,63}$")
+
+var (
+	ErrClientNotFound  = errors.New("client not found")
+	ErrStaticClient    = errors.New("client is defined in configuration file")
+	ErrInvalidMetadata = errors.New("invalid client metadata")
+)
+
+// grant types client can be allowed to use
+var supportedGrantTypes = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeDeviceCode, GrantTypeClientCredentials, GrantTypeTokenExchange}
+
+// initClients validates clients from configuration file, invalid configuration stops the server
+func initClients() {
+	for i := range _cfg.OAuthServer.Clients {
+		if err := ValidateClient(&_cfg.OAuthServer.Clients[i]); err != nil {
+			log.Panic("Invalid OAuth client configuration: ", err)
+		}
+	}
+}
+
+// FindClient looks up client in configuration file first, then in the database, clients waiting
+// for approval are not returned
+func FindClient(clientId string) *utils.Client {
+	client := FindRegisteredClient(clientId)
+	if client == nil || client.Pending {
+		return nil
+	}
+	return client
+}
+
+// FindRegisteredClient looks up client including clients waiting for approval
+func FindRegisteredClient(clientId string) *utils.Client {
+	if client := findStaticClient(clientId); client != nil {
+		return client
+	}
+	client := &utils.Client{}
+	if err := storage.Get(bucketClients, clientId, client); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Error("Unable to load OAuth client: ", err)
+		}
+		return nil
+	}
+	return client
+}
+
+// IsStaticClient returns true for client defined in configuration file
+func IsStaticClient(clientId string) bool {
+	return findStaticClient(clientId) != nil
+}
+
+func findStaticClient(clientId string) *utils.Client {
+	for _, v := range _cfg.OAuthServer.Clients {
+		if v.ClientId == clientId {
+			return &v
+		}
+	}
+	return nil
+}
+
+// ListClients returns clients from configuration file and clients registered in the database
+func ListClients() ([]utils.Client, []utils.Client, error) {
+	var registered []utils.Client
+	err := storage.List(bucketClients, func(key string, data []byte) error {
+		client := utils.Client{}
+		if err := json.Unmarshal(data, &client); err != nil {
+			return err
+		}
+		registered = append(registered, client)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(registered, func(i, j int) bool { return registered[i].ClientId < registered[j].ClientId })
+	return _cfg.OAuthServer.Clients, registered, nil
+}
+
+// SaveClient stores client in the database, clients from configuration file can not be overridden
+func SaveClient(client *utils.Client) error {
+	if findStaticClient(client.ClientId) != nil {
+		return ErrStaticClient
+	}
+	if err := ValidateClient(client); err != nil {
+		return err
+	}
+	return storage.Put(bucketClients, client.ClientId, client, time.Time{})
+}
+
+func DeleteClient(clientId string) error {
+	if findStaticClient(clientId) != nil {
+		return ErrStaticClient
+	}
+	if FindRegisteredClient(clientId) == nil {
+		return ErrClientNotFound
+	}
+	if err := storage.Delete(bucketRegistrationTokens, clientId); err != nil {
+		return err
+	}
+	return storage.Delete(bucketClients, clientId)
+}
+
+// ValidateClient checks client metadata and fills in defaults
+func ValidateClient(client *utils.Client) error {
+	if !clientIdValidRegex.MatchString(client.ClientId) {
+		return fmt.Errorf("%w: invalid client_id '%s'", ErrInvalidMetadata, client.ClientId)
+	}
+	if client.ClientSecretHash != "" {
+		if _, err := bcrypt.Cost([]byte(client.ClientSecretHash)); err != nil {
+			return fmt.Errorf("%w: client_secret_hash of '%s' is not bcrypt hash", ErrInvalidMetadata, client.ClientId)
+		}
+	}
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{GrantTypeAuthorizationCode}
+	}
+	for _, v := range client.GrantTypes {
+		if !IsGrantTypeSupported(v) {
+			return fmt.Errorf("%w: unsupported grant type '%s' of '%s'", ErrInvalidMetadata, v, client.ClientId)
+		}
+	}
+	for _, v := range client.RedirectUris {
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return fmt.Errorf("%w: invalid redirect URI '%s' of '%s'", ErrInvalidMetadata, v, client.ClientId)
+		}
+	}
+	for _, v := range client.PostLogoutRedirectUris {
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return fmt.Errorf("%w: invalid post logout redirect URI '%s' of '%s'", ErrInvalidMetadata, v, client.ClientId)
+		}
+	}
+	if client.BackchannelLogoutUri != "" {
+		u, err := url.Parse(client.BackchannelLogoutUri)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return fmt.Errorf("%w: invalid back-channel logout URI of '%s'", ErrInvalidMetadata, client.ClientId)
+		}
+	}
+	if IsGrantTypeAllowed(client, GrantTypeAuthorizationCode) && len(client.RedirectUris) == 0 {
+		return fmt.Errorf("%w: client '%s' has no redirect URI", ErrInvalidMetadata, client.ClientId)
+	}
+	if IsGrantTypeAllowed(client, GrantTypeClientCredentials) && IsPublicClient(client) {
+		return fmt.Errorf("%w: public client '%s' can not use client_credentials grant", ErrInvalidMetadata, client.ClientId)
+	}
+	if IsGrantTypeAllowed(client, GrantTypeTokenExchange) && IsPublicClient(client) {
+		return fmt.Errorf("%w: public client '%s' can not use token exchange grant", ErrInvalidMetadata, client.ClientId)
+	}
+	if IsGrantTypeAllowed(client, GrantTypeTokenExchange) && len(client.ExchangeAudiences) == 0 {
+		return fmt.Errorf("%w: client '%s' has no exchange audience", ErrInvalidMetadata, client.ClientId)
+	}
+	if client.AccessTokenDuration < 0 || client.IdTokenDuration < 0 || client.RefreshTokenDuration < 0 {
+		return fmt.Errorf("%w: negative token lifetime of '%s'", ErrInvalidMetadata, client.ClientId)
+	}
+	return nil
+}
+
+// HashClientSecret returns hash of client secret kept in configuration or database
+func HashClientSecret(secret string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// IsPublicClient returns true for clients without secret (SPA, native apps), such clients have to use PKCE
+func IsPublicClient(client *utils.Client) bool {
+	return client.ClientSecretHash == ""
+}
+
+func IsValidRedirectUri(client *utils.Client, redirectUri string) bool {
+	return utils.Contains(client.RedirectUris, redirectUri)
+}
+
+func IsValidPostLogoutRedirectUri(client *utils.Client, redirectUri string) bool {
+	return utils.Contains(client.PostLogoutRedirectUris, redirectUri)
+}
+
+func IsGrantTypeSupported(grantType string) bool {
+	return utils.Contains(supportedGrantTypes, grantType)
+}
+
+func IsGrantTypeAllowed(client *utils.Client, grantType string) bool {
+	return utils.Contains(client.GrantTypes, grantType)
+}
+
+// IsProviderAllowed returns true when user of the client can sign in with identity provider, all providers
+// are allowed when client does not restrict them
+func IsProviderAllowed(client *utils.Client, provider string) bool {
+	return len(client.Providers) == 0 || utils.Contains(client.Providers, provider)
+}
+
+// ClientAudience returns audience of tokens issued to the client
+func ClientAudience(client *utils.Client) string {
+	if client.Audience != "" {
+		return client.Audience
+	}
+	return _cfg.OAuthServer.DefaultAudience
+}
+
+// AccessTokenDuration returns lifetime of access tokens issued to the client
+func AccessTokenDuration(client *utils.Client) time.Duration {
+	if client != nil && client.AccessTokenDuration > 0 {
+		return time.Second * time.Duration(client.AccessTokenDuration)
+	}
+	return time.Second * time.Duration(_cfg.OAuthServer.Duration)
+}
+
+// IdTokenDuration returns lifetime of id_tokens issued to the client
+func IdTokenDuration(client *utils.Client) time.Duration {
+	if client != nil && client.IdTokenDuration > 0 {
+		return time.Second * time.Duration(client.IdTokenDuration)
+	}
+	return time.Second * time.Duration(_cfg.OAuthServer.Duration)
+}
+
+// AuthenticateClient authenticates client using client_secret_basic or client_secret_post method,
+// public clients are identified by client_id only
+func AuthenticateClient(r *http.Request) (*utils.Client, error) {
+	clientId, clientSecret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 requires form-urlencoded credentials in authorization header
+		var err error
+		if clientId, err = url.QueryUnescape(clientId); err != nil {
+			return nil, ErrInvalidClient("malformed client credentials")
+		}
+		if clientSecret, err = url.QueryUnescape(clientSecret); err != nil {
+			return nil, ErrInvalidClient("malformed client credentials")
+		}
+	} else {
+		clientId = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientId == "" {
+		return nil, ErrInvalidClient("missing client authentication")
+	}
+
+	client := FindClient(clientId)
+	if client == nil {
+		log.Warn("Unknown OAuth client: ", clientId)
+		return nil, ErrInvalidClient("client authentication failed")
+	}
+	if IsPublicClient(client) {
+		return client, nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(client.ClientSecretHash), []byte(clientSecret)) != nil {
+		log.Warn("Invalid secret for OAuth client: ", clientId)
+		return nil, ErrInvalidClient("client authentication failed")
+	}
+	return client, nil
+}
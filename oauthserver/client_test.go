@@ -0,0 +1,124 @@
+package oauthserver
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+const testClientSecret = "client-secret"
+
+// saveTestClient stores confidential client with testClientSecret in the database
+func saveTestClient(t *testing.T, client *utils.Client) *utils.Client {
+	t.Helper()
+	hash, err := HashClientSecret(testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ClientSecretHash = hash
+	if err := SaveClient(client); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestValidateClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  utils.Client
+		wantErr bool
+	}{
+		{name: "valid", client: utils.Client{ClientId: "app", RedirectUris: []string{testRedirectUri}}},
+		{name: "invalid client id", client: utils.Client{ClientId: "a b", RedirectUris: []string{testRedirectUri}}, wantErr: true},
+		{name: "secret is not hashed", client: utils.Client{ClientId: "app", ClientSecretHash: "secret", RedirectUris: []string{testRedirectUri}}, wantErr: true},
+		{name: "without redirect URI", client: utils.Client{ClientId: "app"}, wantErr: true},
+		{name: "relative redirect URI", client: utils.Client{ClientId: "app", RedirectUris: []string{"/callback"}}, wantErr: true},
+		{name: "redirect URI with fragment", client: utils.Client{ClientId: "app", RedirectUris: []string{testRedirectUri + "#token"}}, wantErr: true},
+		{name: "unsupported grant type", client: utils.Client{ClientId: "app", RedirectUris: []string{testRedirectUri}, GrantTypes: []string{"password"}}, wantErr: true},
+		{name: "negative token lifetime", client: utils.Client{ClientId: "app", RedirectUris: []string{testRedirectUri}, AccessTokenDuration: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateClient(&tt.client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !IsGrantTypeAllowed(&tt.client, GrantTypeAuthorizationCode) {
+				t.Fatalf("default grant type is not set: %v", tt.client.GrantTypes)
+			}
+		})
+	}
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	saveTestClient(t, &utils.Client{ClientId: "confidential", RedirectUris: []string{testRedirectUri}})
+	if err := SaveClient(&utils.Client{ClientId: "public-app", RedirectUris: []string{testRedirectUri}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		basic        []string
+		form         url.Values
+		wantClientId string
+	}{
+		{name: "client_secret_basic", basic: []string{"confidential", testClientSecret}, wantClientId: "confidential"},
+		{name: "client_secret_basic form-urlencoded", basic: []string{"confidential", url.QueryEscape(testClientSecret)}, wantClientId: "confidential"},
+		{name: "client_secret_post", form: url.Values{"client_id": {"confidential"}, "client_secret": {testClientSecret}}, wantClientId: "confidential"},
+		{name: "wrong secret", basic: []string{"confidential", "wrong"}},
+		{name: "missing secret", form: url.Values{"client_id": {"confidential"}}},
+		{name: "unknown client", basic: []string{"unknown", testClientSecret}},
+		{name: "missing authentication"},
+		{name: "public client", form: url.Values{"client_id": {"public-app"}}, wantClientId: "public-app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/oauth2/v1/token", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basic != nil {
+				r.SetBasicAuth(tt.basic[0], tt.basic[1])
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			client, err := AuthenticateClient(r)
+			if tt.wantClientId == "" {
+				if err == nil {
+					t.Fatalf("client %s was authenticated", client.ClientId)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if client.ClientId != tt.wantClientId {
+				t.Fatalf("client = %s, want %s", client.ClientId, tt.wantClientId)
+			}
+		})
+	}
+}
+
+func TestIsValidRedirectUri(t *testing.T) {
+	client := &utils.Client{ClientId: "app", RedirectUris: []string{testRedirectUri}}
+	tests := []struct {
+		name        string
+		redirectUri string
+		want        bool
+	}{
+		{name: "registered", redirectUri: testRedirectUri, want: true},
+		{name: "different path", redirectUri: testRedirectUri + "/other"},
+		{name: "additional query", redirectUri: testRedirectUri + "?next=/admin"},
+		{name: "different scheme", redirectUri: strings.Replace(testRedirectUri, "https", "http", 1)},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidRedirectUri(client, tt.redirectUri); got != tt.want {
+				t.Fatalf("IsValidRedirectUri(%s) = %v, want %v", tt.redirectUri, got, tt.want)
+			}
+		})
+	}
+}
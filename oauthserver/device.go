@@ -0,0 +1,316 @@
+package oauthserver
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	bucketDeviceCodes     = "device_codes"
+	bucketDeviceUserCodes = "device_user_codes"
+	bucketDeviceApprovals = "device_approvals"
+	bucketDeviceFailures  = "device_user_code_failures"
+
+	deviceCodeDuration   = 600
+	devicePollInterval   = 5
+	deviceSlowDownPeriod = 5
+
+	// user code alphabet without vowels and similar looking characters (RFC 8628 section 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// client IP is blocked for device code lifetime after failed user code entries
+	maxClientUserCodeFailures = 10
+	// pending device authorization is invalidated after failed user code entries of all clients during its lifetime,
+	// so user code can not be guessed from many addresses
+	maxDeviceUserCodeFailures = 100
+	// key of failed user code entries of all clients
+	allUserCodeFailures = "*"
+)
+
+var (
+	ErrDeviceAuthorizationNotFound = errors.New("device authorization not found")
+	ErrTooManyUserCodeFailures     = errors.New("too many failed user code entries")
+)
+
+// DeviceAuthorization is pending authorization of device waiting for user to enter user code (RFC 8628)
+type DeviceAuthorization struct {
+	ClientId     string `json:"client_id"`
+	Scope        string `json:"scope,omitempty"`
+	Audience     string `json:"audience"`
+	UserCode     string `json:"user_code"`
+	Interval     int64  `json:"interval"`
+	LastPolledAt int64  `json:"last_polled_at,omitempty"`
+	ExpiryAt     int64  `json:"exp"`
+	// Failures is count of failed user code entries of all clients when authorization started
+	Failures int64 `json:"failures"`
+}
+
+// userCodeFailures counts failed user code entries
+type userCodeFailures struct {
+	Count    int64 `json:"count"`
+	ExpiryAt int64 `json:"exp,omitempty"`
+}
+
+// deviceApproval is decision of the user, it is kept apart from device authorization updated by polling
+type deviceApproval struct {
+	Denied      bool                    `json:"denied,omitempty"`
+	Params      model.Params            `json:"params"`
+	UserDetails *model.SysApiUserDetail `json:"user_details,omitempty"`
+	AuthTime    int64                   `json:"auth_time"`
+}
+
+// DeviceAuthorizationResponse is response of device authorization endpoint (RFC 8628 section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+func ErrAuthorizationPending() *OAuthError {
+	return NewOAuthError("authorization_pending", "user has not yet completed authorization", http.StatusBadRequest)
+}
+
+func ErrSlowDown() *OAuthError {
+	return NewOAuthError("slow_down", "polling too frequently", http.StatusBadRequest)
+}
+
+func ErrAccessDenied(description string) *OAuthError {
+	return NewOAuthError("access_denied", description, http.StatusBadRequest)
+}
+
+func ErrExpiredDeviceCode() *OAuthError {
+	return NewOAuthError("expired_token", "device code has expired", http.StatusBadRequest)
+}
+
+// DeviceVerificationUri is page where user enters user code
+func DeviceVerificationUri() string {
+	return _cfg.OAuthServer.Issuer + "/device"
+}
+
+// CreateDeviceAuthorization starts device authorization of the client, device polls token endpoint
+// with device code while user signs in on another device using user code
+func CreateDeviceAuthorization(client *utils.Client, scope string) (*DeviceAuthorizationResponse, error) {
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+	deviceCode := utils.GenerateRandomString(32)
+	expiryAt := time.Now().Add(deviceCodeDuration * time.Second)
+	device := &DeviceAuthorization{
+		ClientId: client.ClientId,
+		Scope:    scope,
+		Audience: ClientAudience(client),
+		UserCode: userCode,
+		Interval: devicePollInterval,
+		ExpiryAt: expiryAt.Unix(),
+		Failures: getUserCodeFailures(allUserCodeFailures).Count,
+	}
+	if err := storage.Put(bucketDeviceCodes, hashValue(deviceCode), device, expiryAt); err != nil {
+		return nil, err
+	}
+	if err := storage.Put(bucketDeviceUserCodes, normalizeUserCode(userCode), hashValue(deviceCode), expiryAt); err != nil {
+		return nil, err
+	}
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationUri:         DeviceVerificationUri(),
+		VerificationUriComplete: DeviceVerificationUri() + "?user_code=" + userCode,
+		ExpiresIn:               deviceCodeDuration,
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+// FindDeviceAuthorization returns pending device authorization of user code entered by user from client IP,
+// failed entries are counted per client IP and per device authorization
+func FindDeviceAuthorization(userCode string, clientIp string) (*DeviceAuthorization, error) {
+	if getUserCodeFailures(clientIp).Count >= maxClientUserCodeFailures {
+		log.Warn("User code entry rejected, too many failures from: ", clientIp)
+		return nil, ErrTooManyUserCodeFailures
+	}
+	_, device, err := findDeviceAuthorization(userCode)
+	if errors.Is(err, ErrDeviceAuthorizationNotFound) {
+		addUserCodeFailure(clientIp, time.Now().Add(deviceCodeDuration*time.Second))
+		addUserCodeFailure(allUserCodeFailures, time.Time{})
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if getUserCodeFailures(allUserCodeFailures).Count-device.Failures >= maxDeviceUserCodeFailures {
+		log.WithFields(log.Fields{
+			"clientId": device.ClientId,
+		}).Warn("Device authorization invalidated, too many failed user code entries")
+		if err := storage.Delete(bucketDeviceUserCodes, normalizeUserCode(userCode)); err != nil {
+			return nil, err
+		}
+		return nil, ErrDeviceAuthorizationNotFound
+	}
+	return device, nil
+}
+
+func getUserCodeFailures(key string) *userCodeFailures {
+	failures := &userCodeFailures{}
+	if err := storage.Get(bucketDeviceFailures, key, failures); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Error("Unable to load failed user code entries: ", err)
+	}
+	return failures
+}
+
+// addUserCodeFailure counts failed entry, expiry of the counter is set by the first failure
+func addUserCodeFailure(key string, expiryAt time.Time) {
+	failures := getUserCodeFailures(key)
+	if failures.Count == 0 && !expiryAt.IsZero() {
+		failures.ExpiryAt = expiryAt.Unix()
+	}
+	failures.Count++
+	expiry := time.Time{}
+	if failures.ExpiryAt != 0 {
+		expiry = time.Unix(failures.ExpiryAt, 0)
+	}
+	if err := storage.Put(bucketDeviceFailures, key, failures, expiry); err != nil {
+		log.Error("Unable to store failed user code entry: ", err)
+	}
+}
+
+func findDeviceAuthorization(userCode string) (string, *DeviceAuthorization, error) {
+	var key string
+	if err := storage.Get(bucketDeviceUserCodes, normalizeUserCode(userCode), &key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", nil, ErrDeviceAuthorizationNotFound
+		}
+		return "", nil, err
+	}
+	device := &DeviceAuthorization{}
+	if err := storage.Get(bucketDeviceCodes, key, device); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", nil, ErrDeviceAuthorizationNotFound
+		}
+		return "", nil, err
+	}
+	return key, device, nil
+}
+
+// ApproveDeviceAuthorization finishes device authorization of signed in user, user code can be used once
+func ApproveDeviceAuthorization(userCode string, params *model.Params, userDetails *model.SysApiUserDetail) error {
+	return decideDeviceAuthorization(userCode, &deviceApproval{Params: *params, UserDetails: userDetails, AuthTime: time.Now().Unix()})
+}
+
+// DenyDeviceAuthorization rejects device authorization, device gets access_denied error
+func DenyDeviceAuthorization(userCode string) error {
+	return decideDeviceAuthorization(userCode, &deviceApproval{Denied: true})
+}
+
+func decideDeviceAuthorization(userCode string, approval *deviceApproval) error {
+	var key string
+	if err := storage.Take(bucketDeviceUserCodes, normalizeUserCode(userCode), &key); err != nil {
+		return ErrDeviceAuthorizationNotFound
+	}
+	device := &DeviceAuthorization{}
+	if err := storage.Get(bucketDeviceCodes, key, device); err != nil {
+		return ErrDeviceAuthorizationNotFound
+	}
+	log.WithFields(log.Fields{
+		"clientId": device.ClientId,
+		"upn":      approval.Params.Upn,
+		"denied":   approval.Denied,
+	}).Info("Device authorization decided")
+	return storage.Put(bucketDeviceApprovals, key, approval, time.Unix(device.ExpiryAt, 0))
+}
+
+// ExchangeDeviceCode issues tokens for device code when user approved authorization, device has to keep
+// polling interval otherwise it is asked to slow down
+func ExchangeDeviceCode(client *utils.Client, deviceCode string, jkt string) (*TokenResponse, error) {
+	if deviceCode == "" {
+		return nil, ErrInvalidRequest("missing device_code")
+	}
+	key := hashValue(deviceCode)
+	device := &DeviceAuthorization{}
+	if err := storage.Get(bucketDeviceCodes, key, device); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrExpiredDeviceCode()
+		}
+		return nil, err
+	}
+	if device.ClientId != client.ClientId {
+		log.Warn("Device code issued to another client: ", device.ClientId, " used by: ", client.ClientId)
+		return nil, ErrInvalidGrant("invalid device code")
+	}
+
+	approval := &deviceApproval{}
+	if err := storage.Take(bucketDeviceApprovals, key, approval); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		now := time.Now().Unix()
+		slowDown := device.LastPolledAt != 0 && now-device.LastPolledAt < device.Interval
+		if slowDown {
+			device.Interval += deviceSlowDownPeriod
+		}
+		device.LastPolledAt = now
+		if err := storage.Put(bucketDeviceCodes, key, device, time.Unix(device.ExpiryAt, 0)); err != nil {
+			return nil, err
+		}
+		if slowDown {
+			return nil, ErrSlowDown()
+		}
+		return nil, ErrAuthorizationPending()
+	}
+	// device code is redeemed once, decision is final
+	if err := storage.Delete(bucketDeviceCodes, key); err != nil {
+		log.Error("Unable to delete device code: ", err)
+	}
+	if approval.Denied {
+		return nil, ErrAccessDenied("user denied device authorization")
+	}
+
+	refresh := &RefreshToken{
+		Scope:       device.Scope,
+		Params:      approval.Params,
+		UserDetails: approval.UserDetails,
+		AuthTime:    approval.AuthTime,
+	}
+	return createTokenResponse(client, refresh, "", jkt)
+}
+
+// generateUserCode returns code in form XXXX-XXXX which is easy to type
+func generateUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLength+1)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			code = append(code, '-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code = append(code, userCodeAlphabet[n.Int64()])
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode ignores case and separators typed by user
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+}
@@ -0,0 +1,158 @@
+package oauthserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+// oauthErrorCode returns error code sent to the client, empty for nil error
+func oauthErrorCode(err error) string {
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestExchangeDeviceCode(t *testing.T) {
+	client := &utils.Client{ClientId: "device", GrantTypes: []string{GrantTypeDeviceCode}}
+	approve := func(t *testing.T, userCode string) {
+		if err := ApproveDeviceAuthorization(userCode, &model.Params{Upn: "user@example.com", Audience: testAudience}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deny := func(t *testing.T, userCode string) {
+		if err := DenyDeviceAuthorization(userCode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// poll is one request of the device, decide is called before it when set
+	type poll struct {
+		decide   func(t *testing.T, userCode string)
+		client   *utils.Client
+		wantCode string
+	}
+	tests := []struct {
+		name  string
+		polls []poll
+	}{
+		{name: "pending", polls: []poll{{wantCode: "authorization_pending"}}},
+		{name: "polling too fast", polls: []poll{{wantCode: "authorization_pending"}, {wantCode: "slow_down"}}},
+		{name: "approved", polls: []poll{{wantCode: "authorization_pending"}, {decide: approve}}},
+		{name: "approved code is redeemed once", polls: []poll{{decide: approve}, {wantCode: "expired_token"}}},
+		{name: "denied", polls: []poll{{decide: deny, wantCode: "access_denied"}, {wantCode: "expired_token"}}},
+		{name: "another client", polls: []poll{{decide: approve, client: &utils.Client{ClientId: "other"}, wantCode: "invalid_grant"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, err := CreateDeviceAuthorization(client, "openid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, p := range tt.polls {
+				if p.decide != nil {
+					p.decide(t, device.UserCode)
+				}
+				pollingClient := client
+				if p.client != nil {
+					pollingClient = p.client
+				}
+				response, err := ExchangeDeviceCode(pollingClient, device.DeviceCode, "")
+				if code := oauthErrorCode(err); code != p.wantCode {
+					t.Fatalf("poll %d: error = %v, want %s", i, err, p.wantCode)
+				}
+				if err == nil && (response.AccessToken == "" || response.IdToken == "") {
+					t.Fatalf("poll %d: unexpected response %+v", i, response)
+				}
+			}
+		})
+	}
+
+	t.Run("unknown device code", func(t *testing.T) {
+		if _, err := ExchangeDeviceCode(client, "unknown", ""); oauthErrorCode(err) != "expired_token" {
+			t.Fatalf("error = %v, want expired_token", err)
+		}
+	})
+}
+
+func TestFindDeviceAuthorization(t *testing.T) {
+	client := &utils.Client{ClientId: "device", GrantTypes: []string{GrantTypeDeviceCode}}
+	newDevice := func(t *testing.T) string {
+		device, err := CreateDeviceAuthorization(client, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return device.UserCode
+	}
+
+	tests := []struct {
+		name     string
+		userCode func(t *testing.T) string
+		clientIp string
+		wantErr  error
+	}{
+		{name: "user code", userCode: newDevice, clientIp: "192.0.2.1"},
+		{name: "typed in lowercase without separator", userCode: func(t *testing.T) string {
+			return strings.ToLower(strings.ReplaceAll(newDevice(t), "-", ""))
+		}, clientIp: "192.0.2.1"},
+		{name: "unknown user code", userCode: func(t *testing.T) string { return "BCDF-GHJK" }, clientIp: "192.0.2.2", wantErr: ErrDeviceAuthorizationNotFound},
+		{name: "used user code", userCode: func(t *testing.T) string {
+			userCode := newDevice(t)
+			if err := DenyDeviceAuthorization(userCode); err != nil {
+				t.Fatal(err)
+			}
+			return userCode
+		}, clientIp: "192.0.2.2", wantErr: ErrDeviceAuthorizationNotFound},
+		{name: "client IP with too many failures", userCode: func(t *testing.T) string {
+			for i := 0; i < maxClientUserCodeFailures; i++ {
+				_, _ = FindDeviceAuthorization("BCDF-GHJK", "192.0.2.3")
+			}
+			return newDevice(t)
+		}, clientIp: "192.0.2.3", wantErr: ErrTooManyUserCodeFailures},
+		{name: "too many failures during device authorization", userCode: func(t *testing.T) string {
+			userCode := newDevice(t)
+			for i := 0; i < maxDeviceUserCodeFailures; i++ {
+				clientIp := fmt.Sprintf("198.51.100.%d", i/(maxClientUserCodeFailures-1))
+				_, _ = FindDeviceAuthorization("BCDF-GHJK", clientIp)
+			}
+			return userCode
+		}, clientIp: "192.0.2.4", wantErr: ErrDeviceAuthorizationNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, err := FindDeviceAuthorization(tt.userCode(t), tt.clientIp)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && device.ClientId != client.ClientId {
+				t.Fatalf("unexpected device authorization %+v", device)
+			}
+		})
+	}
+}
+
+func TestGenerateUserCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		userCode, err := generateUserCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(userCode) != userCodeLength+1 || userCode[userCodeLength/2] != '-' {
+			t.Fatalf("user code %s is not in form XXXX-XXXX", userCode)
+		}
+		for _, c := range strings.ReplaceAll(userCode, "-", "") {
+			if !strings.ContainsRune(userCodeAlphabet, c) {
+				t.Fatalf("user code %s contains character out of alphabet", userCode)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package oauthserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+const (
+	bucketDeviceLoginConfirmations = "device_login_confirmations"
+
+	deviceLoginConfirmationDuration = 600
+)
+
+// DeviceLoginUserCode derives short user code from code of device login started by Shieldoo client (state
+// parameter of login page), client shows the same code so user can check that login belongs to the device:
+// first 8 bytes of SHA-256 of the code mapped to alphabet BCDFGHJKLMNPQRSTVWXZ (byte modulo 20), XXXX-XXXX
+func DeviceLoginUserCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	userCode := make([]byte, 0, userCodeLength+1)
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			userCode = append(userCode, '-')
+		}
+		userCode = append(userCode, userCodeAlphabet[int(sum[i])%len(userCodeAlphabet)])
+	}
+	return string(userCode)
+}
+
+// ConfirmDeviceLogin records that user confirmed device login, returned token binds confirmation to browser
+func ConfirmDeviceLogin(code string) (string, error) {
+	token := utils.GenerateRandomString(32)
+	err := storage.Put(bucketDeviceLoginConfirmations, hashValue(token), code,
+		time.Now().Add(deviceLoginConfirmationDuration*time.Second))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// IsDeviceLoginConfirmed returns true when user confirmed device login with the code in browser holding the token
+func IsDeviceLoginConfirmed(token string, code string) bool {
+	if token == "" {
+		return false
+	}
+	var confirmed string
+	if err := storage.Get(bucketDeviceLoginConfirmations, hashValue(token), &confirmed); err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(confirmed), []byte(code)) == 1
+}
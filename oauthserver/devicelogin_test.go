@@ -0,0 +1,47 @@
+package oauthserver
+
+import "testing"
+
+func TestDeviceLoginUserCode(t *testing.T) {
+	userCode := DeviceLoginUserCode("device-login-code")
+	if len(userCode) != userCodeLength+1 || userCode[userCodeLength/2] != '-' {
+		t.Fatalf("user code %s is not in form XXXX-XXXX", userCode)
+	}
+	if DeviceLoginUserCode("device-login-code") != userCode {
+		t.Fatal("user code of the same login differs")
+	}
+	if DeviceLoginUserCode("another-login-code") == userCode {
+		t.Fatal("user codes of different logins are equal")
+	}
+}
+
+func TestIsDeviceLoginConfirmed(t *testing.T) {
+	token, err := ConfirmDeviceLogin("device-login-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := ConfirmDeviceLogin("another-login-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		code  string
+		want  bool
+	}{
+		{name: "confirmed login", token: token, code: "device-login-code", want: true},
+		{name: "login confirmed in another browser", token: otherToken, code: "device-login-code"},
+		{name: "another login", token: token, code: "another-login-code"},
+		{name: "without token", code: "device-login-code"},
+		{name: "unknown token", token: "unknown", code: "device-login-code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsDeviceLoginConfirmed(tt.token, tt.code); got != tt.want {
+				t.Fatalf("IsDeviceLoginConfirmed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package oauthserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketDPoPProofs = "dpop_proofs"
+
+	// TokenTypeDPoP is token type of access tokens bound to DPoP key (RFC 9449 section 5)
+	TokenTypeDPoP = verifier.AuthSchemeDPoP
+	// DPoPHeader is HTTP header carrying DPoP proof
+	DPoPHeader = "DPoP"
+)
+
+func ErrInvalidDPoPProof(description string) *OAuthError {
+	return NewOAuthError("invalid_dpop_proof", description, http.StatusBadRequest)
+}
+
+// IsDPoPRequired checks whether client has to send DPoP proof at token endpoint
+func IsDPoPRequired(client *utils.Client) bool {
+	return client != nil && client.DPoPBoundAccessTokens
+}
+
+// VerifyDPoPProof verifies DPoP proof sent to endpoint of this server and returns thumbprint of its key,
+// empty thumbprint is returned for request without proof, every proof can be used once
+func VerifyDPoPProof(r *http.Request, endpoint string, accessToken string) (string, error) {
+	proofs := r.Header.Values(DPoPHeader)
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	if len(proofs) > 1 {
+		return "", ErrInvalidDPoPProof("multiple DPoP proofs")
+	}
+	proof, err := verifier.VerifyProof(proofs[0], r.Method, _cfg.OAuthServer.Issuer+endpoint, accessToken, verifier.DefaultProofMaxAge)
+	if err != nil {
+		log.Debug("Invalid DPoP proof: ", err)
+		return "", ErrInvalidDPoPProof(err.Error())
+	}
+	if isProofReplayed(proof) {
+		log.Warn("Replay of DPoP proof: ", proof.Id)
+		return "", ErrInvalidDPoPProof("DPoP proof has been used")
+	}
+	return proof.Jkt, nil
+}
+
+// isProofReplayed remembers proof until it is too old to be accepted, unavailable storage is considered as replay
+func isProofReplayed(proof *verifier.Proof) bool {
+	key := hashValue(proof.Jkt + ":" + proof.Id)
+	var issuedAt int64
+	if err := storage.Get(bucketDPoPProofs, key, &issuedAt); err == nil {
+		return true
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		log.Error("Unable to check DPoP proofs: ", err)
+		return true
+	}
+	// accepted proofs are at most max age old or ahead
+	expiryAt := proof.IssuedAt.Add(2 * verifier.DefaultProofMaxAge)
+	if err := storage.Put(bucketDPoPProofs, key, proof.IssuedAt.Unix(), expiryAt); err != nil {
+		log.Error("Unable to store DPoP proof: ", err)
+		return true
+	}
+	return false
+}
+
+// VerifyTokenBinding checks that token bound to DPoP key is presented with DPoP scheme and proof of the key,
+// bearer tokens have to be presented with Bearer scheme
+func VerifyTokenBinding(r *http.Request, endpoint string, scheme string, token string, payload *Payload) error {
+	if payload.Confirmation == nil {
+		if scheme == TokenTypeDPoP {
+			return NewOAuthError("invalid_token", "token is not bound to DPoP key", http.StatusUnauthorized)
+		}
+		return nil
+	}
+	if scheme != TokenTypeDPoP {
+		return NewOAuthError("invalid_token", "token is bound to DPoP key", http.StatusUnauthorized)
+	}
+	jkt, err := VerifyDPoPProof(r, endpoint, token)
+	if err == nil && jkt == "" {
+		err = ErrInvalidDPoPProof("missing DPoP proof")
+	}
+	if err == nil && jkt != payload.Confirmation.Jkt {
+		err = ErrInvalidDPoPProof("DPoP key does not match token")
+	}
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) {
+			oauthErr.Status = http.StatusUnauthorized
+		}
+		return err
+	}
+	return nil
+}
+
+// accessTokenType is token_type of token response, tokens bound to DPoP key are DPoP tokens
+func accessTokenType(jkt string) string {
+	if jkt != "" {
+		return TokenTypeDPoP
+	}
+	return "Bearer"
+}
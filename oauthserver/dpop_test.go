@@ -0,0 +1,109 @@
+package oauthserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
+)
+
+const testEndpoint = "/oauth2/v1/userinfo"
+
+// testProof is DPoP proof of request to endpoint of the server, ath is set when access token is not empty
+type testProof struct {
+	jti         string
+	method      string
+	uri         string
+	issuedAt    time.Time
+	accessToken string
+}
+
+func (p testProof) sign(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	public, err := jwk.New(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := map[string]interface{}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"jti": p.jti, "htm": p.method, "htu": p.uri, "iat": p.issuedAt.Unix()}
+	if p.accessToken != "" {
+		claims["ath"] = verifier.AccessTokenHash(p.accessToken)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = header
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken := "access-token"
+	valid := func() testProof {
+		return testProof{
+			jti:         utils.GenerateRandomString(16),
+			method:      "GET",
+			uri:         testIssuer + testEndpoint,
+			issuedAt:    time.Now(),
+			accessToken: accessToken,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		proofs  []testProof
+		replay  bool
+		wantJkt bool
+		wantErr bool
+	}{
+		{name: "without proof"},
+		{name: "valid", proofs: []testProof{valid()}, wantJkt: true},
+		{name: "replayed jti", proofs: []testProof{valid()}, replay: true, wantErr: true},
+		{name: "multiple proofs", proofs: []testProof{valid(), valid()}, wantErr: true},
+		{name: "wrong htm", proofs: []testProof{func() testProof { p := valid(); p.method = "POST"; return p }()}, wantErr: true},
+		{name: "wrong htu", proofs: []testProof{func() testProof { p := valid(); p.uri = testIssuer + "/oauth2/v1/token"; return p }()}, wantErr: true},
+		{name: "stale iat", proofs: []testProof{func() testProof { p := valid(); p.issuedAt = time.Now().Add(-5 * time.Minute); return p }()}, wantErr: true},
+		{name: "ath mismatch", proofs: []testProof{func() testProof { p := valid(); p.accessToken = "another-token"; return p }()}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", testIssuer+testEndpoint, nil)
+			for _, p := range tt.proofs {
+				r.Header.Add(DPoPHeader, p.sign(t, key))
+			}
+			if tt.replay {
+				if _, err := VerifyDPoPProof(r, testEndpoint, accessToken); err != nil {
+					t.Fatalf("first use of proof failed: %v", err)
+				}
+			}
+			jkt, err := VerifyDPoPProof(r, testEndpoint, accessToken)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (jkt != "") != tt.wantJkt {
+				t.Fatalf("jkt = %q, wantJkt %v", jkt, tt.wantJkt)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package oauthserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenEncryption encrypts access tokens of the audience so only its backend can read claims
+type tokenEncryption struct {
+	audience  string
+	alg       jwa.KeyEncryptionAlgorithm
+	kid       string
+	publicKey interface{}
+	// privateKey is set when server has to read encrypted tokens of the audience
+	privateKey interface{}
+}
+
+// tokenEncryptions are keyed by audience
+var tokenEncryptions map[string]*tokenEncryption
+
+func initTokenEncryption(audiences []utils.StaticAudience) error {
+	tokenEncryptions = map[string]*tokenEncryption{}
+	for _, v := range audiences {
+		if v.Encryption.Alg == "" && v.Encryption.PublicKeyPath == "" {
+			continue
+		}
+		encryption, err := newTokenEncryption(v.Name, v.Encryption)
+		if err != nil {
+			return fmt.Errorf("encryption of audience %s: %w", v.Name, err)
+		}
+		tokenEncryptions[v.Name] = encryption
+		log.WithFields(log.Fields{
+			"audience": v.Name,
+			"alg":      v.Encryption.Alg,
+		}).Info("Access tokens of audience are encrypted")
+	}
+	return nil
+}
+
+func newTokenEncryption(audience string, cfg utils.TokenEncryption) (*tokenEncryption, error) {
+	publicBytes, err := os.ReadFile(cfg.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	var privateBytes []byte
+	if cfg.PrivateKeyPath != "" {
+		if privateBytes, err = os.ReadFile(cfg.PrivateKeyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	encryption := &tokenEncryption{audience: audience, alg: jwa.KeyEncryptionAlgorithm(cfg.Alg), kid: cfg.JwkId}
+	switch encryption.alg {
+	case jwa.RSA_OAEP_256:
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicBytes)
+		if err != nil {
+			return nil, err
+		}
+		encryption.publicKey = publicKey
+		if privateBytes != nil {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateBytes)
+			if err != nil {
+				return nil, err
+			}
+			if !privateKey.PublicKey.Equal(publicKey) {
+				return nil, errors.New("public key does not match private key")
+			}
+			encryption.privateKey = privateKey
+		}
+	case jwa.ECDH_ES:
+		publicKey, err := jwt.ParseECPublicKeyFromPEM(publicBytes)
+		if err != nil {
+			return nil, err
+		}
+		encryption.publicKey = publicKey
+		if privateBytes != nil {
+			privateKey, err := jwt.ParseECPrivateKeyFromPEM(privateBytes)
+			if err != nil {
+				return nil, err
+			}
+			if !privateKey.PublicKey.Equal(publicKey) {
+				return nil, errors.New("public key does not match private key")
+			}
+			encryption.privateKey = privateKey
+		}
+	default:
+		return nil, errors.New("unsupported algorithm " + cfg.Alg)
+	}
+	return encryption, nil
+}
+
+// encrypt wraps signed token in JWE (nested JWT, RFC 7519 section 5.2)
+func (encryption *tokenEncryption) encrypt(signed string) (string, error) {
+	headers := jwe.NewHeaders()
+	if err := headers.Set(jwe.ContentTypeKey, "JWT"); err != nil {
+		return "", err
+	}
+	if encryption.kid != "" {
+		if err := headers.Set(jwe.KeyIDKey, encryption.kid); err != nil {
+			return "", err
+		}
+	}
+	encrypted, err := jwe.Encrypt([]byte(signed), encryption.alg, encryption.publicKey,
+		jwa.ContentEncryptionAlgorithm(verifier.ContentEncryption), jwa.NoCompress, jwe.WithProtectedHeaders(headers))
+	if err != nil {
+		return "", err
+	}
+	return string(encrypted), nil
+}
+
+// encryptToken encrypts signed access token when encryption is configured for its audience
+func encryptToken(audience string, signed string) (string, error) {
+	encryption, ok := tokenEncryptions[audience]
+	if !ok {
+		return signed, nil
+	}
+	return encryption.encrypt(signed)
+}
+
+// decryptToken returns signed token nested in token encrypted for audience whose private key is configured
+// and the audience, signed tokens are returned unchanged
+func decryptToken(token string) (string, string, error) {
+	if !verifier.IsEncrypted(token) {
+		return token, "", nil
+	}
+	for _, encryption := range tokenEncryptions {
+		if encryption.privateKey == nil {
+			continue
+		}
+		if signed, err := verifier.Decrypt(token, encryption.privateKey); err == nil {
+			return signed, encryption.audience, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: unable to decrypt token", ErrInvalidToken)
+}
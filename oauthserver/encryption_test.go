@@ -0,0 +1,108 @@
+package oauthserver
+
+import (
+	"testing"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
+)
+
+// testEncryptedAudience configures encryption of tokens of the audience with new key
+func testEncryptedAudience(t *testing.T, name string, alg jwa.KeyEncryptionAlgorithm, withPrivateKey bool) utils.StaticAudience {
+	t.Helper()
+	signerAlg := ES256
+	if alg == jwa.RSA_OAEP_256 {
+		signerAlg = RS256
+	}
+	privatePath, publicPath := writeTestKey(t, newTestSigner(t, signerAlg))
+	audience := utils.StaticAudience{Name: name, Encryption: utils.TokenEncryption{Alg: alg.String(), PublicKeyPath: publicPath, JwkId: name + "-enc"}}
+	if withPrivateKey {
+		audience.Encryption.PrivateKeyPath = privatePath
+	}
+	return audience
+}
+
+func TestTokenEncryption(t *testing.T) {
+	audiences := []utils.StaticAudience{
+		testEncryptedAudience(t, "rsa-backend", jwa.RSA_OAEP_256, true),
+		testEncryptedAudience(t, "ec-backend", jwa.ECDH_ES, true),
+		testEncryptedAudience(t, "opaque-backend", jwa.ECDH_ES, false),
+	}
+	if err := initTokenEncryption(audiences); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tokenEncryptions = map[string]*tokenEncryption{} })
+
+	// token of one audience encrypted for another one
+	signed := createTestToken(t, "app", "rsa-backend")
+	misdirected, err := tokenEncryptions["ec-backend"].encrypt(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		wantEncrypted bool
+		wantErr       bool
+	}{
+		{name: "audience without encryption", token: createTestToken(t, "app", testAudience)},
+		{name: "RSA-OAEP-256", token: createTestToken(t, "app", "rsa-backend"), wantEncrypted: true},
+		{name: "ECDH-ES", token: createTestToken(t, "app", "ec-backend"), wantEncrypted: true},
+		{name: "server without private key of the audience", token: createTestToken(t, "app", "opaque-backend"), wantEncrypted: true, wantErr: true},
+		{name: "encrypted for another audience", token: misdirected, wantEncrypted: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if encrypted := verifier.IsEncrypted(tt.token); encrypted != tt.wantEncrypted {
+				t.Fatalf("encrypted = %v, want %v", encrypted, tt.wantEncrypted)
+			}
+			_, err := VerifyToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("key of another audience", func(t *testing.T) {
+		token := createTestToken(t, "app", "ec-backend")
+		if _, err := verifier.Decrypt(token, tokenEncryptions["rsa-backend"].privateKey); err == nil {
+			t.Fatal("token is decrypted by key of another audience")
+		}
+		if _, err := verifier.Decrypt(token, tokenEncryptions["ec-backend"].privateKey); err != nil {
+			t.Fatalf("token is not decrypted by key of its audience: %v", err)
+		}
+	})
+}
+
+func TestNewTokenEncryption(t *testing.T) {
+	rsa := testEncryptedAudience(t, "rsa-backend", jwa.RSA_OAEP_256, true)
+	ec := testEncryptedAudience(t, "ec-backend", jwa.ECDH_ES, true)
+	mismatched := ec
+	mismatched.Encryption.PrivateKeyPath = testEncryptedAudience(t, "other", jwa.ECDH_ES, true).Encryption.PrivateKeyPath
+	wrongAlg := rsa
+	wrongAlg.Encryption.Alg = jwa.ECDH_ES.String()
+	unsupported := ec
+	unsupported.Encryption.Alg = "RSA1_5"
+
+	tests := []struct {
+		name     string
+		audience utils.StaticAudience
+		wantErr  bool
+	}{
+		{name: "RSA-OAEP-256", audience: rsa},
+		{name: "ECDH-ES", audience: ec},
+		{name: "private key of another key pair", audience: mismatched, wantErr: true},
+		{name: "RSA key for ECDH-ES", audience: wrongAlg, wantErr: true},
+		{name: "unsupported algorithm", audience: unsupported, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTokenEncryption(tt.audience.Name, tt.audience.Encryption)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
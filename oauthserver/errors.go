@@ -0,0 +1,45 @@
+package oauthserver
+
+import "net/http"
+
+// OAuthError is error returned to OAuth clients as defined in RFC 6749 section 5.2
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func NewOAuthError(code string, description string, status int) *OAuthError {
+	return &OAuthError{Code: code, Description: description, Status: status}
+}
+
+func ErrInvalidRequest(description string) *OAuthError {
+	return NewOAuthError("invalid_request", description, http.StatusBadRequest)
+}
+
+func ErrInvalidClient(description string) *OAuthError {
+	return NewOAuthError("invalid_client", description, http.StatusUnauthorized)
+}
+
+func ErrInvalidGrant(description string) *OAuthError {
+	return NewOAuthError("invalid_grant", description, http.StatusBadRequest)
+}
+
+func ErrInvalidScope(description string) *OAuthError {
+	return NewOAuthError("invalid_scope", description, http.StatusBadRequest)
+}
+
+func ErrUnauthorizedClient(description string) *OAuthError {
+	return NewOAuthError("unauthorized_client", description, http.StatusBadRequest)
+}
+
+func ErrUnsupportedGrantType(description string) *OAuthError {
+	return NewOAuthError("unsupported_grant_type", description, http.StatusBadRequest)
+}
@@ -0,0 +1,68 @@
+package oauthserver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// token type identifiers (RFC 8693 section 3)
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJwt         = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeIdToken     = "urn:ietf:params:oauth:token-type:id_token"
+
+	anyExchangeAudience = "*"
+)
+
+func ErrInvalidTarget(description string) *OAuthError {
+	return NewOAuthError("invalid_target", description, http.StatusBadRequest)
+}
+
+// IsExchangeAudienceAllowed returns true when client can exchange tokens for the audience
+func IsExchangeAudienceAllowed(client *utils.Client, audience string) bool {
+	return utils.Contains(client.ExchangeAudiences, anyExchangeAudience) || utils.Contains(client.ExchangeAudiences, audience)
+}
+
+// IsSubjectTokenAllowed returns true when client can exchange the token, id_token has to be issued to the client,
+// access token to the client or for audience the client can exchange tokens for
+func IsSubjectTokenAllowed(client *utils.Client, payload *Payload) bool {
+	if payload.TokenUse == TokenUseId {
+		return payload.Aud == client.ClientId
+	}
+	return payload.ClientId == client.ClientId || IsExchangeAudienceAllowed(client, payload.Aud)
+}
+
+// ExchangeToken issues access token for user of subject token, params carry user and target audience,
+// user is authorized for the audience by the caller, refresh token is not issued
+func ExchangeToken(client *utils.Client, params *model.Params, userDetails *model.SysApiUserDetail, requestedTokenType string, jkt string) (*TokenResponse, error) {
+	if IsPublicClient(client) {
+		return nil, ErrUnauthorizedClient("public client can not use token exchange grant")
+	}
+	if requestedTokenType == "" {
+		requestedTokenType = TokenTypeAccessToken
+	}
+	if requestedTokenType != TokenTypeAccessToken && requestedTokenType != TokenTypeJwt {
+		return nil, ErrInvalidRequest("unsupported requested_token_type")
+	}
+	params.Jkt = jkt
+	if params.SessionId != "" {
+		if err := recordSessionClient(params.SessionId, client); err != nil {
+			return nil, err
+		}
+	}
+	accessToken, expiryAt, err := createAccessToken(client, params, userDetails)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken:     accessToken,
+		TokenType:       accessTokenType(jkt),
+		ExpiresIn:       int64(time.Until(expiryAt).Seconds()),
+		IssuedTokenType: requestedTokenType,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package oauthserver
+
+import (
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// IntrospectionResponse is response of introspection endpoint (RFC 7662 section 2.2), inactive token
+// has only active field
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientId  string   `json:"client_id,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Id        string   `json:"jti,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Upn       string   `json:"upn,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Aud       string   `json:"aud,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Provider  string   `json:"provider,omitempty"`
+	Tenant    string   `json:"tenant,omitempty"`
+	IssueAt   int64    `json:"iat,omitempty"`
+	ExpiryAt  int64    `json:"exp,omitempty"`
+	// Confirmation is key of DPoP-bound token (RFC 9449 section 6.2)
+	Confirmation *verifier.Confirmation `json:"cnf,omitempty"`
+}
+
+// Introspect returns state of token presented by authenticated client, access tokens can be introspected
+// by the client they were issued to and by clients of their audience, refresh tokens only by the client
+// they were issued to
+func Introspect(client *utils.Client, token string, tokenTypeHint string) *IntrospectionResponse {
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		if response := introspectRefreshToken(client, token); response.Active {
+			return response
+		}
+		return introspectAccessToken(client, token)
+	}
+	if response := introspectAccessToken(client, token); response.Active {
+		return response
+	}
+	return introspectRefreshToken(client, token)
+}
+
+func introspectAccessToken(client *utils.Client, token string) *IntrospectionResponse {
+	payload, err := VerifyToken(token)
+	if err != nil {
+		log.Debug("Introspected token is not valid: ", err)
+		return &IntrospectionResponse{}
+	}
+	if !isIntrospectionAllowed(client, payload) {
+		log.Debug("Introspected token is not issued to or for the client ", client.ClientId)
+		return &IntrospectionResponse{}
+	}
+	response := &IntrospectionResponse{
+		Active:       true,
+		TokenType:    "Bearer",
+		Confirmation: payload.Confirmation,
+		ClientId:     payload.ClientId,
+		Issuer:       payload.Issuer,
+		Id:           payload.Id.String(),
+		Subject:      payload.Subject,
+		Upn:          payload.Upn,
+		Name:         payload.Name,
+		Aud:          payload.Aud,
+		Roles:        payload.Roles,
+		Provider:     payload.Provider,
+		Tenant:       payload.Tenant,
+	}
+	if payload.Confirmation != nil {
+		response.TokenType = TokenTypeDPoP
+	}
+	if payload.IssueAt != nil {
+		response.IssueAt = payload.IssueAt.Unix()
+	}
+	if payload.ExpiryAt != nil {
+		response.ExpiryAt = payload.ExpiryAt.Unix()
+	}
+	return response
+}
+
+// isIntrospectionAllowed checks that token was issued to the client or its audience is the client,
+// audience of the client is the resource server which the client stands for
+func isIntrospectionAllowed(client *utils.Client, payload *Payload) bool {
+	if payload.ClientId != "" && payload.ClientId == client.ClientId {
+		return true
+	}
+	return payload.Aud == client.ClientId || (client.Audience != "" && payload.Aud == client.Audience)
+}
+
+func introspectRefreshToken(client *utils.Client, token string) *IntrospectionResponse {
+	refresh, ok := findActiveRefreshToken(token)
+	if !ok || refresh.ClientId != client.ClientId {
+		return &IntrospectionResponse{}
+	}
+	response := &IntrospectionResponse{
+		Active:   true,
+		Scope:    refresh.Scope,
+		ClientId: refresh.ClientId,
+		Issuer:   _cfg.OAuthServer.Issuer,
+		Subject:  refresh.Params.Upn,
+		Upn:      refresh.Params.Upn,
+		Name:     refresh.Params.Name,
+		Aud:      refresh.Params.Audience,
+		Provider: refresh.Params.Provider,
+		Tenant:   refresh.Params.Tenant,
+		ExpiryAt: refresh.ExpiryAt,
+	}
+	if refresh.UserDetails != nil {
+		response.Roles = refresh.UserDetails.Roles
+	}
+	return response
+}
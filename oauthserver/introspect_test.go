@@ -0,0 +1,52 @@
+package oauthserver
+
+import (
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+func TestIntrospect(t *testing.T) {
+	client := &utils.Client{ClientId: "app"}
+	resourceServer := &utils.Client{ClientId: "billa-backend", Audience: testAudience}
+	other := &utils.Client{ClientId: "other"}
+
+	accessToken := createTestToken(t, client.ClientId, testAudience)
+	refreshToken, err := createRefreshToken(client, &RefreshToken{Params: model.Params{Upn: "user@example.com", Audience: testAudience}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		client        *utils.Client
+		token         string
+		tokenTypeHint string
+		wantActive    bool
+	}{
+		{name: "access token of the client", client: client, token: accessToken, wantActive: true},
+		{name: "access token with refresh_token hint", client: client, token: accessToken, tokenTypeHint: TokenTypeHintRefreshToken, wantActive: true},
+		{name: "access token for resource server", client: resourceServer, token: accessToken, wantActive: true},
+		{name: "access token for resource server identified by client id", client: &utils.Client{ClientId: testAudience}, token: accessToken, wantActive: true},
+		{name: "access token of another client", client: other, token: accessToken},
+		{name: "refresh token of the client", client: client, token: refreshToken, wantActive: true},
+		{name: "refresh token with access_token hint", client: client, token: refreshToken, tokenTypeHint: TokenTypeHintAccessToken, wantActive: true},
+		{name: "refresh token of another client", client: resourceServer, token: refreshToken},
+		{name: "invalid token", client: client, token: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := Introspect(tt.client, tt.token, tt.tokenTypeHint)
+			if response.Active != tt.wantActive {
+				t.Fatalf("active = %v, want %v", response.Active, tt.wantActive)
+			}
+			if !response.Active && (response.Upn != "" || response.ClientId != "") {
+				t.Fatalf("inactive token discloses claims: %+v", response)
+			}
+			if response.Active && (response.Upn != "user@example.com" || response.Aud != testAudience) {
+				t.Fatalf("unexpected response %+v", response)
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package oauthserver
 
 import (
 	"encoding/json"
-	"errors"
 
 	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -12,22 +13,126 @@ type JwksList struct {
 	Keys []jwk.Key `json:"keys"`
 }
 
+// OpenIdConfiguration is OpenID Connect discovery document (OpenID Connect Discovery 1.0, RFC 8414)
 type OpenIdConfiguration struct {
-	Issuer                string `json:"issuer"`
-	AuthorizationEndpoint string `json:"authorization_endpoint"`
-	JwksUri               string `json:"jwks_uri"`
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint"`
+	UserInfoEndpoint                           string   `json:"userinfo_endpoint"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint"`
+	EndSessionEndpoint                         string   `json:"end_session_endpoint"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint,omitempty"`
+	PushedAuthorizationRequestEndpoint         string   `json:"pushed_authorization_request_endpoint"`
+	JwksUri                                    string   `json:"jwks_uri"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	ResponseModesSupported                     []string `json:"response_modes_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+	IdTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationEndpointAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	AuthorizationResponseIssParameterSupported bool     `json:"authorization_response_iss_parameter_supported"`
+	BackchannelLogoutSupported                 bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSessionSupported          bool     `json:"backchannel_logout_session_supported"`
+	ClaimsParameterSupported                   bool     `json:"claims_parameter_supported"`
+	RequestParameterSupported                  bool     `json:"request_parameter_supported"`
+	RequestUriParameterSupported               bool     `json:"request_uri_parameter_supported"`
+	RequirePushedAuthorizationRequests         bool     `json:"require_pushed_authorization_requests"`
+	DPoPSigningAlgValuesSupported              []string `json:"dpop_signing_alg_values_supported"`
 }
 
+// claims of tokens issued by the server
+var supportedClaims = []string{
+	"iss", "sub", "aud", "exp", "iat", "jti", "upn", "name", "provider", "tenant", "roles",
+	"nonce", "auth_time", "client_id", "sid", "cnf", "token_use",
+}
+
+// GenerateJwks returns public keys used for verification of tokens, all keys of key set are published
 func GenerateJwks() *JwksList {
-	jwkInfo, err := generateJwkInfo()
-	if err != nil {
+	keys := publishedKeys()
+	if len(keys) == 0 {
 		return nil
 	}
-	return &JwksList{Keys: []jwk.Key{jwkInfo}}
+	jwks := &JwksList{}
+	for _, v := range keys {
+		jwkInfo, err := generateJwkInfo(v)
+		if err != nil {
+			return nil
+		}
+		jwks.Keys = append(jwks.Keys, jwkInfo)
+	}
+	return jwks
+}
+
+// signingAlgorithms returns algorithm of active key first followed by algorithms of other keys of the server,
+// keys of audiences do not sign id_tokens
+func signingAlgorithms() []string {
+	algs := []string{globJwtMaker.Algorithm()}
+	for _, v := range serverKeys() {
+		if !utils.Contains(algs, v.Algorithm()) {
+			algs = append(algs, v.Algorithm())
+		}
+	}
+	return algs
+}
+
+// publishedKeys returns asymmetric keys of the server and keys of audiences signing own tokens
+func publishedKeys() []asymmetricMaker {
+	return append(serverKeys(), audienceKeys()...)
 }
 
+// serverKeys returns asymmetric keys of the active Maker
+func serverKeys() []asymmetricMaker {
+	switch maker := globJwtMaker.(type) {
+	case *KeySetMaker:
+		return maker.publishedKeys()
+	case asymmetricMaker:
+		return []asymmetricMaker{maker}
+	}
+	return nil
+}
+
+// GenerateOpenIdConfiguration describes the running server, signing algorithm is given by active Maker
 func GenerateOpenIdConfiguration() *OpenIdConfiguration {
-	return &OpenIdConfiguration{Issuer: _cfg.OAuthServer.Issuer, JwksUri: _cfg.OAuthServer.Issuer + "/oauth2/v1/certs"}
+	clientAuthMethods := []string{ClientAuthMethodSecretBasic, ClientAuthMethodSecretPost}
+	registrationEndpoint := ""
+	if _cfg.OAuthServer.RegistrationToken != "" {
+		registrationEndpoint = _cfg.OAuthServer.Issuer + "/oauth2/v1/register"
+	}
+	return &OpenIdConfiguration{
+		Issuer:                                     _cfg.OAuthServer.Issuer,
+		AuthorizationEndpoint:                      _cfg.OAuthServer.Issuer + "/oauth2/v1/authorize",
+		TokenEndpoint:                              _cfg.OAuthServer.Issuer + "/oauth2/v1/token",
+		IntrospectionEndpoint:                      _cfg.OAuthServer.Issuer + "/oauth2/v1/introspect",
+		RevocationEndpoint:                         _cfg.OAuthServer.Issuer + "/oauth2/v1/revoke",
+		UserInfoEndpoint:                           _cfg.OAuthServer.Issuer + "/oauth2/v1/userinfo",
+		DeviceAuthorizationEndpoint:                _cfg.OAuthServer.Issuer + "/oauth2/v1/device_authorization",
+		EndSessionEndpoint:                         _cfg.OAuthServer.Issuer + "/oauth2/v1/logout",
+		RegistrationEndpoint:                       registrationEndpoint,
+		PushedAuthorizationRequestEndpoint:         _cfg.OAuthServer.Issuer + "/oauth2/v1/par",
+		JwksUri:                                    _cfg.OAuthServer.Issuer + "/oauth2/v1/certs",
+		ResponseTypesSupported:                     []string{ResponseTypeCode},
+		ResponseModesSupported:                     []string{"query"},
+		GrantTypesSupported:                        supportedGrantTypes,
+		SubjectTypesSupported:                      []string{"public"},
+		ScopesSupported:                            []string{ScopeOpenId, "profile", "email"},
+		ClaimsSupported:                            supportedClaims,
+		IdTokenSigningAlgValuesSupported:           signingAlgorithms(),
+		TokenEndpointAuthMethodsSupported:          append(clientAuthMethods, ClientAuthMethodNone),
+		IntrospectionEndpointAuthMethodsSupported:  clientAuthMethods,
+		RevocationEndpointAuthMethodsSupported:     append(clientAuthMethods, ClientAuthMethodNone),
+		CodeChallengeMethodsSupported:              []string{CodeChallengeMethodS256},
+		AuthorizationResponseIssParameterSupported: true,
+		BackchannelLogoutSupported:                 true,
+		BackchannelLogoutSessionSupported:          true,
+		DPoPSigningAlgValuesSupported:              verifier.ProofAlgorithms,
+	}
 }
 
 func printUsedKeys() {
@@ -42,22 +147,14 @@ func printUsedKeys() {
 	log.Info("Keys used for generating JWT signature: \n", string(bytes))
 }
 
-func generateJwkInfo() (jwk.Key, error) {
+func generateJwkInfo(maker asymmetricMaker) (jwk.Key, error) {
 
-	jWtRs256Maker, ok := globJwtMaker.(*JWTRS256Maker)
-	if !ok {
-		return nil, errors.New("rs256 is not enabled")
-	}
-	publicKeyJwk, err := jwk.New(jWtRs256Maker.verifyKey)
+	publicKeyJwk, err := jwk.New(maker.publicKey())
 	if err != nil {
-		log.Error("failed to create RSA key: %s\n", err)
-		return nil, err
-	}
-	if _, ok := publicKeyJwk.(jwk.RSAPublicKey); !ok {
-		log.Error("expected jwk.RSAPublicKey, got %T\n", publicKeyJwk)
+		log.Errorf("failed to create public key: %s", err)
 		return nil, err
 	}
-	err = publicKeyJwk.Set(jwk.KeyIDKey, jWtRs256Maker.jwkId)
+	err = publicKeyJwk.Set(jwk.KeyIDKey, maker.keyId())
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +162,7 @@ func generateJwkInfo() (jwk.Key, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = publicKeyJwk.Set(jwk.AlgorithmKey, "RS256")
+	err = publicKeyJwk.Set(jwk.AlgorithmKey, maker.Algorithm())
 	if err != nil {
 		return nil, err
 	}
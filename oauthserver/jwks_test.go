@@ -0,0 +1,70 @@
+package oauthserver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+func TestGenerateOpenIdConfiguration(t *testing.T) {
+	data, err := json.Marshal(GenerateOpenIdConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "issuer", want: `"` + testIssuer + `"`},
+		{name: "authorization_endpoint", want: `"` + testIssuer + `/oauth2/v1/authorize"`},
+		{name: "token_endpoint", want: `"` + testIssuer + `/oauth2/v1/token"`},
+		{name: "jwks_uri", want: `"` + testIssuer + `/oauth2/v1/certs"`},
+		{name: "response_types_supported", want: `["code"]`},
+		{name: "code_challenge_methods_supported", want: `["S256"]`},
+		{name: "id_token_signing_alg_values_supported", want: `["HS256"]`},
+		{name: "token_endpoint_auth_methods_supported", want: `["client_secret_basic","client_secret_post","none"]`},
+		{name: "introspection_endpoint_auth_methods_supported", want: `["client_secret_basic","client_secret_post"]`},
+		{name: "authorization_response_iss_parameter_supported", want: `true`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(document[tt.name]); got != tt.want {
+				t.Fatalf("%s = %s, want %s", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("endpoints of the issuer", func(t *testing.T) {
+		for name, value := range document {
+			if !strings.HasSuffix(name, "_endpoint") && !strings.HasSuffix(name, "_uri") {
+				continue
+			}
+			var endpoint string
+			if err := json.Unmarshal(value, &endpoint); err != nil {
+				t.Fatal(err)
+			}
+			if endpoint != "" && !strings.HasPrefix(endpoint, testIssuer+"/") {
+				t.Fatalf("%s = %s is not endpoint of the issuer", name, endpoint)
+			}
+		}
+	})
+
+	t.Run("supported grant types", func(t *testing.T) {
+		var grantTypes []string
+		if err := json.Unmarshal(document["grant_types_supported"], &grantTypes); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken} {
+			if !utils.Contains(grantTypes, v) {
+				t.Fatalf("grant type %s is not advertised: %v", v, grantTypes)
+			}
+		}
+	})
+}
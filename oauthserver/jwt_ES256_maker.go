@@ -0,0 +1,77 @@
+package oauthserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"os"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+)
+
+// JWTES256Maker signs tokens with ECDSA P-256 key, signatures are much shorter than RS256 ones
+type JWTES256Maker struct {
+	verifyKey *ecdsa.PublicKey
+	signKey   *ecdsa.PrivateKey
+	jwkId     string
+}
+
+func NewJWTES256Maker(privateKeyPath string, publicKeyPath string, jwkId string) (Maker, error) {
+	signBytes, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	signKey, err := jwt.ParseECPrivateKeyFromPEM(signBytes)
+	if err != nil {
+		return nil, err
+	}
+	verifyBytes, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	verifyKey, err := jwt.ParseECPublicKeyFromPEM(verifyBytes)
+	if err != nil {
+		return nil, err
+	}
+	if signKey.Curve != elliptic.P256() || verifyKey.Curve != elliptic.P256() {
+		return nil, errors.New("ES256 requires P-256 keys")
+	}
+	if !signKey.PublicKey.Equal(verifyKey) {
+		return nil, errors.New("ES256 public key does not match private key")
+	}
+	return &JWTES256Maker{signKey: signKey, verifyKey: verifyKey, jwkId: jwkId}, nil
+}
+
+func (maker *JWTES256Maker) CreateToken(params *model.Params, duration time.Duration, details *model.SysApiUserDetail) (string, time.Time, error) {
+	payload, err := NewPayload(params, duration, details)
+	if err != nil {
+		return "", time.Now().UTC(), err
+	}
+
+	rets, reterr := maker.SignPayload(payload)
+	return rets, payload.ExpiryAt.Time, reterr
+}
+
+func (maker *JWTES256Maker) SignPayload(payload *Payload) (string, error) {
+	jwtToken := newJwt(jwt.SigningMethodES256, payload)
+	jwtToken.Header["kid"] = maker.jwkId
+	return jwtToken.SignedString(maker.signKey)
+}
+
+func (maker *JWTES256Maker) Algorithm() string {
+	return ES256
+}
+
+func (maker *JWTES256Maker) VerifyToken(token string) (*Payload, error) {
+	return verifyTokenSignature(token, ES256, maker.jwkId, maker.verifyKey)
+}
+
+func (maker *JWTES256Maker) publicKey() interface{} {
+	return maker.verifyKey
+}
+
+func (maker *JWTES256Maker) keyId() string {
+	return maker.jwkId
+}
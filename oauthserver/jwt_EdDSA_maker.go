@@ -0,0 +1,81 @@
+package oauthserver
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+)
+
+// JWTEdDSAMaker signs tokens with Ed25519 key, the smallest signatures of supported methods
+type JWTEdDSAMaker struct {
+	verifyKey ed25519.PublicKey
+	signKey   ed25519.PrivateKey
+	jwkId     string
+}
+
+func NewJWTEdDSAMaker(privateKeyPath string, publicKeyPath string, jwkId string) (Maker, error) {
+	signBytes, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	parsedSignKey, err := jwt.ParseEdPrivateKeyFromPEM(signBytes)
+	if err != nil {
+		return nil, err
+	}
+	verifyBytes, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	parsedVerifyKey, err := jwt.ParseEdPublicKeyFromPEM(verifyBytes)
+	if err != nil {
+		return nil, err
+	}
+	signKey, ok := parsedSignKey.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("EdDSA requires Ed25519 private key")
+	}
+	verifyKey, ok := parsedVerifyKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("EdDSA requires Ed25519 public key")
+	}
+	if !verifyKey.Equal(signKey.Public()) {
+		return nil, errors.New("EdDSA public key does not match private key")
+	}
+	return &JWTEdDSAMaker{signKey: signKey, verifyKey: verifyKey, jwkId: jwkId}, nil
+}
+
+func (maker *JWTEdDSAMaker) CreateToken(params *model.Params, duration time.Duration, details *model.SysApiUserDetail) (string, time.Time, error) {
+	payload, err := NewPayload(params, duration, details)
+	if err != nil {
+		return "", time.Now().UTC(), err
+	}
+
+	rets, reterr := maker.SignPayload(payload)
+	return rets, payload.ExpiryAt.Time, reterr
+}
+
+func (maker *JWTEdDSAMaker) SignPayload(payload *Payload) (string, error) {
+	jwtToken := newJwt(jwt.SigningMethodEdDSA, payload)
+	jwtToken.Header["kid"] = maker.jwkId
+	return jwtToken.SignedString(maker.signKey)
+}
+
+func (maker *JWTEdDSAMaker) Algorithm() string {
+	return EdDSA
+}
+
+func (maker *JWTEdDSAMaker) VerifyToken(token string) (*Payload, error) {
+	return verifyTokenSignature(token, EdDSA, maker.jwkId, maker.verifyKey)
+}
+
+func (maker *JWTEdDSAMaker) publicKey() interface{} {
+	return maker.verifyKey
+}
+
+func (maker *JWTEdDSAMaker) keyId() string {
+	return maker.jwkId
+}
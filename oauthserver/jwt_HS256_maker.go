@@ -1,7 +1,6 @@
 package oauthserver
 
 import (
-	"errors"
 	"fmt"
 	"time"
 
@@ -28,33 +27,20 @@ func (maker *JWTHS256Maker) CreateToken(params *model.Params, duration time.Dura
 		return "", time.Now().UTC(), err
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	rets, reterr := jwtToken.SignedString([]byte(maker.secretKey))
+	rets, reterr := maker.SignPayload(payload)
 	return rets, payload.ExpiryAt.Time, reterr
 }
 
-func (maker *JWTHS256Maker) VerifyToken(token string) (*Payload, error) {
-	keyFunc := func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(maker.secretKey), nil
-	}
-
-	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
-	if err != nil {
-		verr, ok := err.(*jwt.ValidationError)
-		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
-			return nil, ErrExpiredToken
-		}
-		return nil, ErrInvalidToken
-	}
+func (maker *JWTHS256Maker) SignPayload(payload *Payload) (string, error) {
+	jwtToken := newJwt(jwt.SigningMethodHS256, payload)
+	return jwtToken.SignedString([]byte(maker.secretKey))
+}
 
-	payload, ok := jwtToken.Claims.(*Payload)
-	if !ok {
-		return nil, ErrInvalidToken
-	}
+func (maker *JWTHS256Maker) Algorithm() string {
+	return HS256
+}
 
-	return payload, nil
+// VerifyToken verifies token without kid header, shared secret has no key id
+func (maker *JWTHS256Maker) VerifyToken(token string) (*Payload, error) {
+	return verifyTokenSignature(token, HS256, "", []byte(maker.secretKey))
 }
@@ -2,7 +2,6 @@ package oauthserver
 
 import (
 	"crypto/rsa"
-	"errors"
 	"io/ioutil"
 	"time"
 
@@ -56,34 +55,28 @@ func (maker *JWTRS256Maker) CreateToken(params *model.Params, duration time.Dura
 		return "", time.Now().UTC(), err
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodRS256, payload)
-	jwtToken.Header["kid"] = maker.jwkId
-	rets, reterr := jwtToken.SignedString(maker.signKey)
+	rets, reterr := maker.SignPayload(payload)
 	return rets, payload.ExpiryAt.Time, reterr
 }
 
-func (maker *JWTRS256Maker) VerifyToken(token string) (*Payload, error) {
-	keyFunc := func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, ErrInvalidToken
-		}
-		return maker.verifyKey, nil
-	}
+func (maker *JWTRS256Maker) SignPayload(payload *Payload) (string, error) {
+	jwtToken := newJwt(jwt.SigningMethodRS256, payload)
+	jwtToken.Header["kid"] = maker.jwkId
+	return jwtToken.SignedString(maker.signKey)
+}
 
-	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
-	if err != nil {
-		verr, ok := err.(*jwt.ValidationError)
-		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
-			return nil, ErrExpiredToken
-		}
-		return nil, ErrInvalidToken
-	}
+func (maker *JWTRS256Maker) Algorithm() string {
+	return RS256
+}
 
-	payload, ok := jwtToken.Claims.(*Payload)
-	if !ok {
-		return nil, ErrInvalidToken
-	}
+func (maker *JWTRS256Maker) publicKey() interface{} {
+	return maker.verifyKey
+}
 
-	return payload, nil
+func (maker *JWTRS256Maker) keyId() string {
+	return maker.jwkId
+}
+
+func (maker *JWTRS256Maker) VerifyToken(token string) (*Payload, error) {
+	return verifyTokenSignature(token, RS256, maker.jwkId, maker.verifyKey)
 }
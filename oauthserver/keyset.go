@@ -0,0 +1,288 @@
+package oauthserver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const bucketSigningKeys = "signing_keys"
+
+// promotions stored by other instances are read from storage after this time
+const keyPromotionRefresh = 10 * time.Second
+
+const (
+	KeyStatusActive   = "active"
+	KeyStatusNext     = "next"
+	KeyStatusPrevious = "previous"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// signingKey is one key of the key set, key is active from its activation time until next key activates
+type signingKey struct {
+	maker      asymmetricMaker
+	kid        string
+	activateAt time.Time
+	promotedAt time.Time
+}
+
+// activation is time of manual activation of the key, or configured activation time when key was not promoted
+func (key *signingKey) activation() time.Time {
+	if !key.promotedAt.IsZero() {
+		return key.promotedAt
+	}
+	return key.activateAt
+}
+
+// keyPromotion is manual activation of the key, it takes precedence over configured activation time
+type keyPromotion struct {
+	ActivatedAt int64 `json:"activated_at"`
+}
+
+// KeyInfo describes key of the key set
+type KeyInfo struct {
+	Kid        string     `json:"kid"`
+	Algorithm  string     `json:"alg"`
+	Status     string     `json:"status"`
+	ActivateAt *time.Time `json:"activate_at,omitempty"`
+}
+
+// KeySetMaker signs tokens with active key and verifies tokens by any key of the set selected by kid,
+// all keys are published in JWKS so verifiers know next key before it is used and previous keys
+// until outstanding tokens expire
+type KeySetMaker struct {
+	mu   sync.RWMutex
+	keys []*signingKey
+	// promotionsLoadedAt is time when promotions were read from storage
+	promotionsLoadedAt time.Time
+}
+
+func NewKeySetMaker(method string, keys []utils.SigningKey) (*KeySetMaker, error) {
+	maker := &KeySetMaker{}
+	for _, v := range keys {
+		keyMethod := v.Method
+		if keyMethod == "" {
+			keyMethod = method
+		}
+		var m Maker
+		var err error
+		switch keyMethod {
+		case RS256:
+			m, err = NewJWTRS256Maker(v.PrivateKeyPath, v.PublicKeyPath, v.JwkId)
+		case ES256:
+			m, err = NewJWTES256Maker(v.PrivateKeyPath, v.PublicKeyPath, v.JwkId)
+		case EdDSA:
+			m, err = NewJWTEdDSAMaker(v.PrivateKeyPath, v.PublicKeyPath, v.JwkId)
+		default:
+			err = errors.New("unsupported method of key set " + keyMethod)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", v.JwkId, err)
+		}
+		if v.JwkId == "" {
+			return nil, errors.New("key of key set has no jwk_id")
+		}
+		key := &signingKey{maker: m.(asymmetricMaker), kid: v.JwkId}
+		if v.ActivateAt != "" {
+			if key.activateAt, err = time.Parse(time.RFC3339, v.ActivateAt); err != nil {
+				return nil, fmt.Errorf("key %s: invalid activate_at: %w", v.JwkId, err)
+			}
+		}
+		if _, err := maker.findKey(v.JwkId); err == nil {
+			return nil, fmt.Errorf("duplicate key %s", v.JwkId)
+		}
+		maker.keys = append(maker.keys, key)
+	}
+	if len(maker.keys) == 0 {
+		return nil, errors.New("key set is empty")
+	}
+	maker.loadPromotions()
+	if maker.activeKey().activation().After(time.Now()) {
+		return nil, errors.New("no key of key set is active yet")
+	}
+	return maker, nil
+}
+
+// loadPromotions applies manual activations stored by PromoteKey of any instance
+func (maker *KeySetMaker) loadPromotions() {
+	for _, key := range maker.keys {
+		promotion := &keyPromotion{}
+		err := storage.Get(bucketSigningKeys, key.kid, promotion)
+		switch {
+		case err == nil:
+			key.promotedAt = time.Unix(promotion.ActivatedAt, 0)
+		case errors.Is(err, storage.ErrNotFound):
+			key.promotedAt = time.Time{}
+		default:
+			log.Error("Unable to load promotion of signing key: ", err)
+		}
+	}
+	maker.promotionsLoadedAt = time.Now()
+}
+
+// refreshPromotions reads promotions from storage again when they were loaded before keyPromotionRefresh,
+// so key promoted by another instance becomes active here too
+func (maker *KeySetMaker) refreshPromotions() {
+	maker.mu.RLock()
+	fresh := time.Since(maker.promotionsLoadedAt) < keyPromotionRefresh
+	maker.mu.RUnlock()
+	if fresh {
+		return
+	}
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+	maker.loadPromotions()
+}
+
+// activeKey returns key with the latest activation time which is not in the future, first configured key
+// is used when no key is active yet
+func (maker *KeySetMaker) activeKey() *signingKey {
+	now := time.Now()
+	var active *signingKey
+	for _, key := range maker.keys {
+		if !key.activation().After(now) && (active == nil || key.activation().After(active.activation())) {
+			active = key
+		}
+	}
+	if active == nil {
+		return maker.keys[0]
+	}
+	return active
+}
+
+func (maker *KeySetMaker) findKey(kid string) (*signingKey, error) {
+	for _, key := range maker.keys {
+		if key.kid == kid {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+func (maker *KeySetMaker) CreateToken(params *model.Params, duration time.Duration, details *model.SysApiUserDetail) (string, time.Time, error) {
+	payload, err := NewPayload(params, duration, details)
+	if err != nil {
+		return "", time.Now().UTC(), err
+	}
+
+	rets, reterr := maker.SignPayload(payload)
+	return rets, payload.ExpiryAt.Time, reterr
+}
+
+func (maker *KeySetMaker) SignPayload(payload *Payload) (string, error) {
+	maker.refreshPromotions()
+	maker.mu.RLock()
+	defer maker.mu.RUnlock()
+	return maker.activeKey().maker.SignPayload(payload)
+}
+
+func (maker *KeySetMaker) Algorithm() string {
+	maker.refreshPromotions()
+	maker.mu.RLock()
+	defer maker.mu.RUnlock()
+	return maker.activeKey().maker.Algorithm()
+}
+
+// VerifyToken verifies token by key selected by kid header
+func (maker *KeySetMaker) VerifyToken(token string) (*Payload, error) {
+	unverified, _, err := new(jwt.Parser).ParseUnverified(token, &Payload{})
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	kid, _ := unverified.Header["kid"].(string)
+	maker.mu.RLock()
+	key, err := maker.findKey(kid)
+	maker.mu.RUnlock()
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return key.maker.VerifyToken(token)
+}
+
+func (maker *KeySetMaker) hasKey(kid string) bool {
+	maker.mu.RLock()
+	defer maker.mu.RUnlock()
+	_, err := maker.findKey(kid)
+	return err == nil
+}
+
+// publishedKeys returns all keys of the set, they are published in JWKS
+func (maker *KeySetMaker) publishedKeys() []asymmetricMaker {
+	maker.mu.RLock()
+	defer maker.mu.RUnlock()
+	keys := make([]asymmetricMaker, 0, len(maker.keys))
+	for _, key := range maker.keys {
+		keys = append(keys, key.maker)
+	}
+	return keys
+}
+
+// Keys returns keys of the set with their status ordered by activation
+func (maker *KeySetMaker) Keys() []KeyInfo {
+	maker.refreshPromotions()
+	maker.mu.RLock()
+	defer maker.mu.RUnlock()
+	active := maker.activeKey()
+	keys := append([]*signingKey{}, maker.keys...)
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].activation().Before(keys[j].activation()) })
+	var result []KeyInfo
+	for _, key := range keys {
+		info := KeyInfo{Kid: key.kid, Algorithm: key.maker.Algorithm(), Status: KeyStatusPrevious}
+		if key == active {
+			info.Status = KeyStatusActive
+		} else if key.activation().After(active.activation()) {
+			info.Status = KeyStatusNext
+		}
+		if !key.activation().IsZero() {
+			activateAt := key.activation().UTC()
+			info.ActivateAt = &activateAt
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// PromoteKey activates key of the set immediately, activation is stored so it survives restart and other
+// instances sharing the storage activate the key within keyPromotionRefresh
+func (maker *KeySetMaker) PromoteKey(kid string) error {
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+	key, err := maker.findKey(kid)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := storage.Put(bucketSigningKeys, kid, &keyPromotion{ActivatedAt: now.Unix()}, time.Time{}); err != nil {
+		return err
+	}
+	key.promotedAt = now
+	log.WithFields(log.Fields{
+		"kid": kid,
+	}).Info("Signing key promoted to active")
+	return nil
+}
+
+// SigningKeys returns keys of configured key set, nil when single key is configured
+func SigningKeys() []KeyInfo {
+	if maker, ok := globJwtMaker.(*KeySetMaker); ok {
+		return maker.Keys()
+	}
+	return nil
+}
+
+// PromoteSigningKey activates key of configured key set
+func PromoteSigningKey(kid string) error {
+	if maker, ok := globJwtMaker.(*KeySetMaker); ok {
+		return maker.PromoteKey(kid)
+	}
+	return ErrUnknownKey
+}
@@ -1,12 +1,55 @@
 package oauthserver
 
 import (
+	"context"
 	"time"
 
+	jwt "github.com/golang-jwt/jwt/v4"
+
 	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
 )
 
 type Maker interface {
 	CreateToken(params *model.Params, duration time.Duration, userDetails *model.SysApiUserDetail) (string, time.Time, error)
+	SignPayload(payload *Payload) (string, error)
 	VerifyToken(token string) (*Payload, error)
+	// Algorithm returns JWS algorithm of signed tokens
+	Algorithm() string
+}
+
+// asymmetricMaker is Maker whose public key is published in JWKS
+type asymmetricMaker interface {
+	Maker
+	publicKey() interface{}
+	keyId() string
+}
+
+// newJwt creates unsigned token of the payload, logout tokens are explicitly typed so they can not be
+// mistaken for access tokens (OpenID Connect Back-Channel Logout 1.0 section 2.4)
+func newJwt(method jwt.SigningMethod, payload *Payload) *jwt.Token {
+	token := jwt.NewWithClaims(method, payload)
+	if payload.Events != nil {
+		token.Header["typ"] = verifier.LogoutTokenType
+	}
+	return token
+}
+
+// verifyTokenSignature verifies token signed by the key with given algorithm only and issued by this server
+func verifyTokenSignature(token string, alg string, kid string, key interface{}) (*Payload, error) {
+	tokenVerifier, err := verifier.New(verifier.Options{
+		Issuer:     _cfg.OAuthServer.Issuer,
+		Algorithms: []string{alg},
+		Keys:       verifier.StaticKeySet{kid: key},
+		// binding is checked by VerifyTokenBinding
+		AcceptBoundTokens: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload := &Payload{}
+	if _, err := tokenVerifier.VerifyWithClaims(context.Background(), token, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
 }
@@ -0,0 +1,142 @@
+package oauthserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+)
+
+// writeTestKey writes PEM encoded private and public key to temporary directory and returns their paths
+func writeTestKey(t *testing.T, key crypto.Signer) (string, string) {
+	t.Helper()
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, "key.pem")
+	publicPath := filepath.Join(dir, "key.pub")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func newTestSigner(t *testing.T, alg string) crypto.Signer {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case RS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newTestMaker(alg string, privatePath string, publicPath string) (Maker, error) {
+	switch alg {
+	case RS256:
+		return NewJWTRS256Maker(privatePath, publicPath, "kid-"+alg)
+	case ES256:
+		return NewJWTES256Maker(privatePath, publicPath, "kid-"+alg)
+	default:
+		return NewJWTEdDSAMaker(privatePath, publicPath, "kid-"+alg)
+	}
+}
+
+// newTestKeyMaker returns maker of the algorithm with new key
+func newTestKeyMaker(t *testing.T, alg string) Maker {
+	t.Helper()
+	privatePath, publicPath := writeTestKey(t, newTestSigner(t, alg))
+	maker, err := newTestMaker(alg, privatePath, publicPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return maker
+}
+
+func TestAsymmetricMakers(t *testing.T) {
+	params := &model.Params{Upn: "user@example.com", Audience: testAudience}
+	for _, alg := range []string{RS256, ES256, EdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			maker := newTestKeyMaker(t, alg)
+			other := newTestKeyMaker(t, alg)
+			if maker.Algorithm() != alg {
+				t.Fatalf("algorithm = %s, want %s", maker.Algorithm(), alg)
+			}
+			token, _, err := maker.CreateToken(params, time.Hour, &model.SysApiUserDetail{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload, err := maker.VerifyToken(token)
+			if err != nil {
+				t.Fatalf("token is not verified: %v", err)
+			}
+			if payload.Upn != params.Upn {
+				t.Fatalf("upn = %s, want %s", payload.Upn, params.Upn)
+			}
+			if _, err := other.VerifyToken(token); err == nil {
+				t.Fatal("token is verified by another key")
+			}
+		})
+	}
+}
+
+func TestAsymmetricMakerKeys(t *testing.T) {
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		alg     string
+		key     crypto.Signer
+		public  crypto.Signer
+		wantErr bool
+	}{
+		{name: "ES256", alg: ES256, key: newTestSigner(t, ES256)},
+		{name: "ES256 with P-384 key", alg: ES256, key: p384, wantErr: true},
+		{name: "ES256 with foreign public key", alg: ES256, key: newTestSigner(t, ES256), public: newTestSigner(t, ES256), wantErr: true},
+		{name: "ES256 with RSA key", alg: ES256, key: newTestSigner(t, RS256), wantErr: true},
+		{name: "EdDSA", alg: EdDSA, key: newTestSigner(t, EdDSA)},
+		{name: "EdDSA with foreign public key", alg: EdDSA, key: newTestSigner(t, EdDSA), public: newTestSigner(t, EdDSA), wantErr: true},
+		{name: "EdDSA with EC key", alg: EdDSA, key: newTestSigner(t, ES256), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privatePath, publicPath := writeTestKey(t, tt.key)
+			if tt.public != nil {
+				_, publicPath = writeTestKey(t, tt.public)
+			}
+			_, err := newTestMaker(tt.alg, privatePath, publicPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
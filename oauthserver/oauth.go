@@ -2,6 +2,7 @@ package oauthserver
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"time"
 
@@ -16,18 +17,25 @@ var _cfg *utils.Config
 const (
 	HS256 = "HS256"
 	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
 )
 
 func Init(cfg *utils.Config) {
 	_cfg = cfg
 
 	var err error
-	switch cfg.OAuthServer.Signing.Method {
-	case HS256:
+	switch {
+	case len(cfg.OAuthServer.Signing.Keys) > 0:
+		globJwtMaker, err = NewKeySetMaker(cfg.OAuthServer.Signing.Method, cfg.OAuthServer.Signing.Keys)
+	case cfg.OAuthServer.Signing.Method == HS256:
 		globJwtMaker, err = NewJWTHS256Maker(cfg.OAuthServer.Signing.Hs256.Secret)
-	case RS256:
+	case cfg.OAuthServer.Signing.Method == RS256:
 		globJwtMaker, err = NewJWTRS256Maker(cfg.OAuthServer.Signing.Rs256.PrivateKeyPath, cfg.OAuthServer.Signing.Rs256.PublicKeyPath, cfg.OAuthServer.Signing.Rs256.JwkId)
-		printUsedKeys()
+	case cfg.OAuthServer.Signing.Method == ES256:
+		globJwtMaker, err = NewJWTES256Maker(cfg.OAuthServer.Signing.Es256.PrivateKeyPath, cfg.OAuthServer.Signing.Es256.PublicKeyPath, cfg.OAuthServer.Signing.Es256.JwkId)
+	case cfg.OAuthServer.Signing.Method == EdDSA:
+		globJwtMaker, err = NewJWTEdDSAMaker(cfg.OAuthServer.Signing.EdDSA.PrivateKeyPath, cfg.OAuthServer.Signing.EdDSA.PublicKeyPath, cfg.OAuthServer.Signing.EdDSA.JwkId)
 	default:
 		err = errors.New("Unknown method " + cfg.OAuthServer.Signing.Method)
 	}
@@ -36,11 +44,51 @@ func Init(cfg *utils.Config) {
 		log.Panic("Unable initialize OauthServer: ", err)
 		os.Exit(1000)
 	}
+	// verifier rejects tokens without audience
+	if cfg.OAuthServer.DefaultAudience == "" {
+		log.Panic("Unable initialize OauthServer: default_audience is not set")
+	}
+	if err := initAudiences(cfg.OAuthServer.StaticAudiences); err != nil {
+		log.Panic("Unable initialize OauthServer: ", err)
+	}
+	if err := initTokenEncryption(cfg.OAuthServer.StaticAudiences); err != nil {
+		log.Panic("Unable initialize OauthServer: ", err)
+	}
+	if len(publishedKeys()) > 0 {
+		printUsedKeys()
+	}
+	initClients()
+	go backchannelLogoutLoop()
 }
 
+// CreateToken creates access token, lifetime is given by the client when user signs in for a client
 func CreateToken(params *model.Params, userDetails *model.SysApiUserDetail) (string, time.Time, error) {
-	return globJwtMaker.CreateToken(params,
-		time.Second*time.Duration(_cfg.OAuthServer.Duration), userDetails)
+	var client *utils.Client
+	if params.ClientId != "" {
+		client = FindClient(params.ClientId)
+	}
+	return createAccessToken(client, params, userDetails)
+}
+
+// createAccessToken creates access token with claims, lifetime and signing key of its audience, lifetime
+// of the client takes precedence, token is encrypted when encryption is configured for the audience
+func createAccessToken(client *utils.Client, params *model.Params, userDetails *model.SysApiUserDetail) (string, time.Time, error) {
+	duration := AccessTokenDuration(client)
+	// lifetime of the audience caps lifetime of the client
+	if d := audienceDuration(params.Audience); d > 0 && (d < duration || client == nil || client.AccessTokenDuration == 0) {
+		duration = d
+	}
+	payload, err := NewPayload(params, duration, userDetails)
+	if err != nil {
+		return "", time.Now().UTC(), err
+	}
+	applyAudience(payload)
+	token, err := audienceMaker(params.Audience).SignPayload(payload)
+	if err != nil {
+		return "", payload.ExpiryAt.Time, err
+	}
+	token, err = encryptToken(params.Audience, token)
+	return token, payload.ExpiryAt.Time, err
 }
 
 func CreateInternalToken(params *model.Params) string {
@@ -53,6 +101,51 @@ func CreateInternalToken(params *model.Params) string {
 	return token
 }
 
+// VerifyToken verifies access token, id_tokens signed by the same key are rejected, so they can not be used
+// instead of access tokens
 func VerifyToken(token string) (*Payload, error) {
-	return globJwtMaker.VerifyToken(token)
+	payload, err := verifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if payload.TokenUse == TokenUseId {
+		return nil, fmt.Errorf("%w: id_token can not be used as access token", ErrInvalidToken)
+	}
+	return payload, nil
+}
+
+// VerifyIdToken verifies id_token issued by the server, access tokens are rejected
+func VerifyIdToken(token string) (*Payload, error) {
+	payload, err := verifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if payload.TokenUse != TokenUseId {
+		return nil, fmt.Errorf("%w: token is not id_token", ErrInvalidToken)
+	}
+	return payload, nil
+}
+
+// verifyToken verifies signature, issuer and expiry of the token and checks that it has not been revoked
+func verifyToken(token string) (*Payload, error) {
+	signed, audience, err := decryptToken(token)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := verifySignedToken(signed)
+	if err != nil {
+		return nil, err
+	}
+	// token encrypted for one audience can not carry claims of another
+	if audience != "" && payload.Aud != audience {
+		return nil, fmt.Errorf("%w: token is not encrypted for its audience", ErrInvalidToken)
+	}
+	// logout tokens can not be used as access token or id_token
+	if payload.Events != nil {
+		return nil, fmt.Errorf("%w: unexpected events claim", ErrInvalidToken)
+	}
+	if IsRevoked(payload) {
+		return nil, ErrRevokedToken
+	}
+	return payload, nil
 }
@@ -0,0 +1,39 @@
+package oauthserver
+
+import (
+	"os"
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+const (
+	testIssuer   = "https://oauth.example.com"
+	testAudience = "billa"
+)
+
+func TestMain(m *testing.M) {
+	_cfg = &utils.Config{}
+	_cfg.OAuthServer.Issuer = testIssuer
+	_cfg.OAuthServer.Duration = 3600
+	_cfg.OAuthServer.DefaultAudience = testAudience
+	storage.Init(_cfg)
+	var err error
+	if globJwtMaker, err = NewJWTHS256Maker("0123456789abcdef0123456789abcdef"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// createTestToken returns access token of the user signed in for the client
+func createTestToken(t *testing.T, clientId string, audience string) string {
+	t.Helper()
+	params := &model.Params{Upn: "user@example.com", Audience: audience, ClientId: clientId}
+	token, _, err := CreateToken(params, &model.SysApiUserDetail{Roles: []string{"USER"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
@@ -0,0 +1,88 @@
+package oauthserver
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketPushedRequests = "pushed_authorization_requests"
+
+	// RequestUriPrefix is prefix of request_uri returned by pushed authorization request endpoint (RFC 9126 section 2.2)
+	RequestUriPrefix = "urn:ietf:params:oauth:request_uri:"
+
+	pushedRequestDuration = 300
+
+	// PushedAuthorization is kind of pushed OAuth authorization request used at authorization endpoint
+	PushedAuthorization = "authorization"
+	// PushedLogin is kind of pushed parameters of login page used at login and device login pages
+	PushedLogin = "login"
+)
+
+var ErrInvalidRequestUri = errors.New("invalid or expired request_uri")
+
+// PushedAuthorizationResponse is response of pushed authorization request endpoint (RFC 9126 section 2.2)
+type PushedAuthorizationResponse struct {
+	RequestUri string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// pushedRequest is request parameters pushed by authenticated client, login page and authorization endpoint
+// get parameters by reference so they can not be tampered with in browser
+type pushedRequest struct {
+	ClientId string     `json:"client_id"`
+	Kind     string     `json:"kind"`
+	Params   url.Values `json:"params"`
+}
+
+// IsPushedRequestRequired checks whether client has to push its requests before user is sent to login page
+func IsPushedRequestRequired(client *utils.Client) bool {
+	return client != nil && client.RequirePushedAuthorizationRequests
+}
+
+// PushAuthorizationRequest stores validated request parameters of the client and returns reference to them,
+// kind is PushedAuthorization or PushedLogin
+func PushAuthorizationRequest(client *utils.Client, kind string, params url.Values) (*PushedAuthorizationResponse, error) {
+	id := utils.GenerateRandomString(32)
+	request := &pushedRequest{ClientId: client.ClientId, Kind: kind, Params: params}
+	err := storage.Put(bucketPushedRequests, id, request, time.Now().Add(pushedRequestDuration*time.Second))
+	if err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"clientId": client.ClientId,
+		"kind":     kind,
+	}).Debug("Authorization request pushed")
+	return &PushedAuthorizationResponse{RequestUri: RequestUriPrefix + id, ExpiresIn: pushedRequestDuration}, nil
+}
+
+// GetPushedAuthorizationRequest returns parameters pushed by the client, request of another kind is rejected
+// and consumed request can not be used again
+func GetPushedAuthorizationRequest(clientId string, kind string, requestUri string, consume bool) (url.Values, error) {
+	if !strings.HasPrefix(requestUri, RequestUriPrefix) {
+		return nil, ErrInvalidRequestUri
+	}
+	id := strings.TrimPrefix(requestUri, RequestUriPrefix)
+	request := &pushedRequest{}
+	if err := storage.Get(bucketPushedRequests, id, request); err != nil {
+		return nil, ErrInvalidRequestUri
+	}
+	if request.ClientId != clientId {
+		log.Warn("Pushed authorization request of client: ", request.ClientId, " used by: ", clientId)
+		return nil, ErrInvalidRequestUri
+	}
+	if request.Kind != kind {
+		log.Warn("Pushed ", request.Kind, " request of client: ", clientId, " used as ", kind, " request")
+		return nil, ErrInvalidRequestUri
+	}
+	if consume && storage.Take(bucketPushedRequests, id, request) != nil {
+		return nil, ErrInvalidRequestUri
+	}
+	return request.Params, nil
+}
@@ -0,0 +1,90 @@
+package oauthserver
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+func TestGetPushedAuthorizationRequest(t *testing.T) {
+	client := &utils.Client{ClientId: "parclient"}
+	push := func(t *testing.T, kind string) string {
+		t.Helper()
+		response, err := PushAuthorizationRequest(client, kind, url.Values{"state": {"pushed-state"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(response.RequestUri, RequestUriPrefix) || response.ExpiresIn != pushedRequestDuration {
+			t.Fatalf("unexpected response %+v", response)
+		}
+		return response.RequestUri
+	}
+
+	tests := []struct {
+		name       string
+		requestUri func(t *testing.T) string
+		clientId   string
+		kind       string
+		wantErr    bool
+	}{
+		{name: "pushed authorization", requestUri: func(t *testing.T) string { return push(t, PushedAuthorization) }, clientId: client.ClientId, kind: PushedAuthorization},
+		{name: "pushed login", requestUri: func(t *testing.T) string { return push(t, PushedLogin) }, clientId: client.ClientId, kind: PushedLogin},
+		{name: "another client", requestUri: func(t *testing.T) string { return push(t, PushedAuthorization) }, clientId: "other", kind: PushedAuthorization, wantErr: true},
+		{name: "login used as authorization", requestUri: func(t *testing.T) string { return push(t, PushedLogin) }, clientId: client.ClientId, kind: PushedAuthorization, wantErr: true},
+		{name: "authorization used as login", requestUri: func(t *testing.T) string { return push(t, PushedAuthorization) }, clientId: client.ClientId, kind: PushedLogin, wantErr: true},
+		{name: "without prefix", requestUri: func(t *testing.T) string {
+			return strings.TrimPrefix(push(t, PushedAuthorization), RequestUriPrefix)
+		}, clientId: client.ClientId, kind: PushedAuthorization, wantErr: true},
+		{name: "unknown", requestUri: func(t *testing.T) string { return RequestUriPrefix + "unknown" }, clientId: client.ClientId, kind: PushedAuthorization, wantErr: true},
+		{name: "consumed", requestUri: func(t *testing.T) string {
+			requestUri := push(t, PushedAuthorization)
+			if _, err := GetPushedAuthorizationRequest(client.ClientId, PushedAuthorization, requestUri, true); err != nil {
+				t.Fatal(err)
+			}
+			return requestUri
+		}, clientId: client.ClientId, kind: PushedAuthorization, wantErr: true},
+		{name: "read without consuming", requestUri: func(t *testing.T) string {
+			requestUri := push(t, PushedLogin)
+			if _, err := GetPushedAuthorizationRequest(client.ClientId, PushedLogin, requestUri, false); err != nil {
+				t.Fatal(err)
+			}
+			return requestUri
+		}, clientId: client.ClientId, kind: PushedLogin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := GetPushedAuthorizationRequest(tt.clientId, tt.kind, tt.requestUri(t), true)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRequestUri) {
+				t.Fatalf("error = %v, want %v", err, ErrInvalidRequestUri)
+			}
+			if err == nil && params.Get("state") != "pushed-state" {
+				t.Fatalf("unexpected params %v", params)
+			}
+		})
+	}
+}
+
+func TestIsPushedRequestRequired(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *utils.Client
+		want   bool
+	}{
+		{name: "required", client: &utils.Client{ClientId: "parclient", RequirePushedAuthorizationRequests: true}, want: true},
+		{name: "not required", client: &utils.Client{ClientId: "app"}},
+		{name: "login without client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPushedRequestRequired(tt.client); got != tt.want {
+				t.Fatalf("IsPushedRequestRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,14 @@
 package oauthserver
 
 import (
-	"errors"
-	"github.com/golang-jwt/jwt/v4"
+	"encoding/json"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
+
 	"github.com/google/uuid"
 	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
 )
 
 // define roles in system
@@ -16,22 +18,39 @@ const (
 	RoleUser          = "USER"
 )
 
+// TokenUseId is token_use claim of id_tokens
+const TokenUseId = "id"
+
 type Payload struct {
-	Issuer   string           `json:"iss"`
-	Id       uuid.UUID        `json:"jti"`
-	Upn      string           `json:"upn"`
-	Aud      string           `json:"aud"`
-	Name     string           `json:"name,omitempty"`
-	Provider string           `json:"provider,omitempty"`
-	Tenant   string           `json:"tenant,omitempty"`
-	IssueAt  *jwt.NumericDate `json:"iat,omitempty"`
-	ExpiryAt *jwt.NumericDate `json:"exp,omitempty"`
-	Roles    []string         `json:"roles,omitempty"`
+	Issuer    string           `json:"iss"`
+	Id        uuid.UUID        `json:"jti"`
+	Subject   string           `json:"sub,omitempty"`
+	Upn       string           `json:"upn"`
+	Aud       string           `json:"aud"`
+	Name      string           `json:"name,omitempty"`
+	Provider  string           `json:"provider,omitempty"`
+	Tenant    string           `json:"tenant,omitempty"`
+	IssueAt   *jwt.NumericDate `json:"iat,omitempty"`
+	ExpiryAt  *jwt.NumericDate `json:"exp,omitempty"`
+	Roles     []string         `json:"roles,omitempty"`
+	Nonce     string           `json:"nonce,omitempty"`
+	ClientId  string           `json:"client_id,omitempty"`
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"`
+	SessionId string           `json:"sid,omitempty"`
+	// TokenUse is set in id_tokens only, access tokens have no token_use claim
+	TokenUse string `json:"token_use,omitempty"`
+	// Events are set in logout tokens only
+	Events map[string]interface{} `json:"events,omitempty"`
+	// Confirmation is set in access tokens bound to DPoP key
+	Confirmation *verifier.Confirmation `json:"cnf,omitempty"`
+	// Extra are static claims of the audience, they are not decoded from verified tokens
+	Extra map[string]string `json:"-"`
 }
 
 var (
-	ErrInvalidToken = errors.New("token is invalid")
-	ErrExpiredToken = errors.New("token has expired")
+	ErrInvalidToken = verifier.ErrInvalidToken
+	ErrExpiredToken = verifier.ErrExpiredToken
+	ErrRevokedToken = verifier.ErrRevokedToken
 )
 
 func NewPayload(params *model.Params, duration time.Duration, details *model.SysApiUserDetail) (*Payload, error) {
@@ -41,25 +60,48 @@ func NewPayload(params *model.Params, duration time.Duration, details *model.Sys
 	}
 
 	var payload = &Payload{
-		Id:       tokenID,
-		Upn:      params.Upn,
-		Name:     params.Name,
-		Aud:      params.Audience,
-		Provider: params.Provider,
-		Tenant:   params.Tenant,
-		Issuer:   _cfg.OAuthServer.Issuer,
-		ExpiryAt: jwt.NewNumericDate(time.Now().Add(duration)),
-		IssueAt:  jwt.NewNumericDate(time.Now()),
+		Id:        tokenID,
+		Subject:   params.Upn,
+		Upn:       params.Upn,
+		Name:      params.Name,
+		Aud:       params.Audience,
+		Provider:  params.Provider,
+		Tenant:    params.Tenant,
+		ClientId:  params.ClientId,
+		SessionId: params.SessionId,
+		Issuer:    _cfg.OAuthServer.Issuer,
+		ExpiryAt:  jwt.NewNumericDate(time.Now().Add(duration)),
+		IssueAt:   jwt.NewNumericDate(time.Now()),
 	}
 	if details != nil {
 		payload.Roles = details.Roles
 	}
+	if params.Jkt != "" {
+		payload.Confirmation = &verifier.Confirmation{Jkt: params.Jkt}
+	}
 	return payload, nil
 }
 
-func (payload *Payload) Valid() error {
-	if time.Now().After(payload.ExpiryAt.Time) {
-		return ErrExpiredToken
+// MarshalJSON adds static claims of the audience to claims of the payload
+func (payload *Payload) MarshalJSON() ([]byte, error) {
+	type claims Payload
+	data, err := json.Marshal((*claims)(payload))
+	if err != nil || len(payload.Extra) == 0 {
+		return data, err
 	}
+	merged := map[string]interface{}{}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for name, value := range payload.Extra {
+		if _, ok := merged[name]; !ok {
+			merged[name] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// Valid implements jwt.Claims, expiry, issuer and audience of the token are checked by verifier package
+func (payload *Payload) Valid() error {
 	return nil
 }
@@ -0,0 +1,169 @@
+package oauthserver
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketRefreshTokens        = "refresh_tokens"
+	bucketRefreshTokenFamilies = "refresh_token_families"
+
+	defaultRefreshTokenDuration = 30 * 24 * 3600
+)
+
+// RefreshToken is server-side state of refresh token, every refresh token belongs to family of tokens
+// rotated from the same authorization
+type RefreshToken struct {
+	FamilyId    string                  `json:"family_id"`
+	ClientId    string                  `json:"client_id"`
+	Scope       string                  `json:"scope,omitempty"`
+	Params      model.Params            `json:"params"`
+	UserDetails *model.SysApiUserDetail `json:"user_details,omitempty"`
+	AuthTime    int64                   `json:"auth_time"`
+	ExpiryAt    int64                   `json:"exp"`
+	// RotatedAt is set when token was exchanged for new one, next use of such token is reuse
+	RotatedAt int64 `json:"rotated_at,omitempty"`
+}
+
+type refreshTokenFamily struct {
+	ClientId  string `json:"client_id"`
+	Upn       string `json:"upn"`
+	SessionId string `json:"sid,omitempty"`
+	Revoked   bool   `json:"revoked,omitempty"`
+}
+
+// RefreshTokenDuration returns lifetime of refresh tokens issued to the client, every rotation issues token
+// with full lifetime
+func RefreshTokenDuration(client *utils.Client) time.Duration {
+	if client != nil && client.RefreshTokenDuration > 0 {
+		return time.Second * time.Duration(client.RefreshTokenDuration)
+	}
+	return time.Second * defaultRefreshTokenDuration
+}
+
+// createRefreshToken stores refresh token, new family is started when token has no family
+func createRefreshToken(client *utils.Client, refresh *RefreshToken) (string, error) {
+	expiryAt := time.Now().Add(RefreshTokenDuration(client))
+	family := &refreshTokenFamily{ClientId: client.ClientId, Upn: refresh.Params.Upn, SessionId: refresh.Params.SessionId}
+	if refresh.FamilyId == "" {
+		refresh.FamilyId = utils.GenerateRandomString(16)
+	} else if err := storage.Get(bucketRefreshTokenFamilies, refresh.FamilyId, family); err != nil || family.Revoked {
+		// family could be revoked while token was rotated
+		return "", ErrInvalidGrant("invalid refresh token")
+	}
+	refresh.ClientId = client.ClientId
+	refresh.ExpiryAt = expiryAt.Unix()
+	refresh.RotatedAt = 0
+
+	// family lives as long as its newest token
+	if err := storage.Put(bucketRefreshTokenFamilies, refresh.FamilyId, family, expiryAt); err != nil {
+		return "", err
+	}
+	token := utils.GenerateRandomString(32)
+	if err := storage.Put(bucketRefreshTokens, hashValue(token), refresh, expiryAt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RedeemRefreshToken marks refresh token as rotated and returns its state, reuse of rotated token
+// revokes whole family because the token could be stolen
+func RedeemRefreshToken(token string, client *utils.Client) (*RefreshToken, error) {
+	key := hashValue(token)
+	refresh := &RefreshToken{}
+	if err := storage.Take(bucketRefreshTokens, key, refresh); err != nil {
+		log.Warn("Unknown, expired or concurrently used refresh token")
+		return nil, ErrInvalidGrant("invalid refresh token")
+	}
+	expiryAt := time.Unix(refresh.ExpiryAt, 0)
+	if refresh.ClientId != client.ClientId {
+		log.Warn("Refresh token issued to another client: ", refresh.ClientId, " used by: ", client.ClientId)
+		_ = storage.Put(bucketRefreshTokens, key, refresh, expiryAt)
+		return nil, ErrInvalidGrant("invalid refresh token")
+	}
+	// rotated token is kept until its expiry to detect reuse
+	rotatedAt := refresh.RotatedAt
+	refresh.RotatedAt = time.Now().Unix()
+	if err := storage.Put(bucketRefreshTokens, key, refresh, expiryAt); err != nil {
+		return nil, err
+	}
+	if rotatedAt != 0 {
+		log.WithFields(log.Fields{
+			"clientId": client.ClientId,
+			"upn":      refresh.Params.Upn,
+			"familyId": refresh.FamilyId,
+		}).Warn("Reuse of rotated refresh token, revoking token family")
+		if err := RevokeRefreshTokenFamily(refresh.FamilyId); err != nil {
+			log.Error("Unable to revoke refresh token family: ", err)
+		}
+		return nil, ErrInvalidGrant("invalid refresh token")
+	}
+
+	family := &refreshTokenFamily{}
+	if err := storage.Get(bucketRefreshTokenFamilies, refresh.FamilyId, family); err != nil || family.Revoked {
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		log.Warn("Refresh token of revoked family used: ", refresh.FamilyId)
+		return nil, ErrInvalidGrant("invalid refresh token")
+	}
+	return refresh, nil
+}
+
+// ReleaseRefreshToken returns redeemed refresh token back to use when new tokens could not be issued,
+// so client can retry without being considered as reuse
+func ReleaseRefreshToken(token string, refresh *RefreshToken) error {
+	released := *refresh
+	released.RotatedAt = 0
+	return storage.Put(bucketRefreshTokens, hashValue(token), &released, time.Unix(refresh.ExpiryAt, 0))
+}
+
+// narrowScope limits scope of refreshed tokens, requested scope can not exceed originally granted scope
+func (refresh *RefreshToken) narrowScope(scope string) error {
+	if scope == "" {
+		return nil
+	}
+	for _, s := range strings.Fields(scope) {
+		if !hasScope(refresh.Scope, s) {
+			return ErrInvalidScope("scope exceeds originally granted scope")
+		}
+	}
+	refresh.Scope = scope
+	return nil
+}
+
+// findActiveRefreshToken returns refresh token which can be exchanged, rotated tokens and tokens of revoked
+// family are not active
+func findActiveRefreshToken(token string) (*RefreshToken, bool) {
+	refresh := &RefreshToken{}
+	if err := storage.Get(bucketRefreshTokens, hashValue(token), refresh); err != nil || refresh.RotatedAt != 0 {
+		return nil, false
+	}
+	family := &refreshTokenFamily{}
+	if err := storage.Get(bucketRefreshTokenFamilies, refresh.FamilyId, family); err != nil || family.Revoked {
+		return nil, false
+	}
+	return refresh, true
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens rotated from the same authorization
+func RevokeRefreshTokenFamily(familyId string) error {
+	family := &refreshTokenFamily{}
+	if err := storage.Get(bucketRefreshTokenFamilies, familyId, family); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	family.Revoked = true
+	// family is kept as long as any of its tokens can be valid
+	return storage.Put(bucketRefreshTokenFamilies, familyId, family,
+		time.Now().Add(RefreshTokenDuration(FindClient(family.ClientId))))
+}
@@ -0,0 +1,114 @@
+package oauthserver
+
+import (
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+func TestRedeemRefreshToken(t *testing.T) {
+	client := &utils.Client{ClientId: "app"}
+	other := &utils.Client{ClientId: "other"}
+
+	// step redeems token issued by previous steps, index 0 is token issued at login
+	type step struct {
+		token   int
+		client  *utils.Client
+		release bool
+		wantErr bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name:  "rotation",
+			steps: []step{{token: 0, client: client}, {token: 1, client: client}, {token: 2, client: client}},
+		},
+		{
+			name: "reuse of rotated token revokes family",
+			steps: []step{
+				{token: 0, client: client},
+				{token: 0, client: client, wantErr: true},
+				{token: 1, client: client, wantErr: true},
+			},
+		},
+		{
+			name: "reuse of older token revokes newest token",
+			steps: []step{
+				{token: 0, client: client},
+				{token: 1, client: client},
+				{token: 0, client: client, wantErr: true},
+				{token: 2, client: client, wantErr: true},
+			},
+		},
+		{
+			name: "token of another client is kept for its client",
+			steps: []step{
+				{token: 0, client: other, wantErr: true},
+				{token: 0, client: client},
+				{token: 1, client: client},
+			},
+		},
+		{
+			name: "released token is not reuse",
+			steps: []step{
+				{token: 0, client: client, release: true},
+				{token: 0, client: client},
+				{token: 1, client: client},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := createRefreshToken(client, &RefreshToken{Params: model.Params{Upn: "user@example.com"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens := []string{token}
+			for i, s := range tt.steps {
+				refresh, err := RedeemRefreshToken(tokens[s.token], s.client)
+				if (err != nil) != s.wantErr {
+					t.Fatalf("step %d: error = %v, wantErr %v", i, err, s.wantErr)
+				}
+				if err != nil {
+					continue
+				}
+				if s.release {
+					if err := ReleaseRefreshToken(tokens[s.token], refresh); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				token, err := createRefreshToken(s.client, refresh)
+				if err != nil {
+					t.Fatalf("step %d: rotation failed: %v", i, err)
+				}
+				tokens = append(tokens, token)
+			}
+		})
+	}
+}
+
+func TestRevokedFamilyCanNotRotate(t *testing.T) {
+	client := &utils.Client{ClientId: "app"}
+	token, err := createRefreshToken(client, &RefreshToken{Params: model.Params{Upn: "user@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := RedeemRefreshToken(token, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// family is revoked while new tokens are being issued
+	if err := RevokeRefreshTokenFamily(refresh.FamilyId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createRefreshToken(client, refresh); err == nil {
+		t.Fatal("token of revoked family was issued")
+	}
+	if _, ok := findActiveRefreshToken(token); ok {
+		t.Fatal("rotated token is active")
+	}
+}
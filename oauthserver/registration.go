@@ -0,0 +1,273 @@
+package oauthserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const bucketRegistrationTokens = "registration_access_tokens"
+
+// grant types client can request at registration, other grants are granted by administrator
+var registrationGrantTypes = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeDeviceCode}
+
+// ClientMetadata is client metadata sent at dynamic client registration (RFC 7591 section 2), audience
+// is extension selecting audience of issued tokens, other settings (roles, providers, back-channel logout)
+// are set by administrator
+type ClientMetadata struct {
+	RedirectUris            []string `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	ClientName              string   `json:"client_name,omitempty"`
+	ClientUri               string   `json:"client_uri,omitempty"`
+	LogoUri                 string   `json:"logo_uri,omitempty"`
+	Contacts                []string `json:"contacts,omitempty"`
+	PostLogoutRedirectUris  []string `json:"post_logout_redirect_uris,omitempty"`
+	Audience                string   `json:"audience,omitempty"`
+	// client can send user to login only with pushed request (RFC 9126 section 6)
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+	// client gets tokens only with DPoP proof (RFC 9449 section 5.2)
+	DPoPBoundAccessTokens bool `json:"dpop_bound_access_tokens,omitempty"`
+}
+
+// ClientInformation is response of registration and client configuration endpoints (RFC 7591 section 3.2.1,
+// RFC 7592 section 3), secret and registration access token are returned at registration only
+type ClientInformation struct {
+	ClientId                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientUri   string `json:"registration_client_uri"`
+	ClientMetadata
+	// Pending is true until administrator approves the client
+	Pending bool `json:"pending"`
+}
+
+func ErrInvalidClientMetadata(description string) *OAuthError {
+	return NewOAuthError("invalid_client_metadata", description, http.StatusBadRequest)
+}
+
+func ErrInvalidRedirectUri(description string) *OAuthError {
+	return NewOAuthError("invalid_redirect_uri", description, http.StatusBadRequest)
+}
+
+func ErrInvalidRegistrationToken() *OAuthError {
+	return NewOAuthError("invalid_token", "invalid registration access token", http.StatusUnauthorized)
+}
+
+// RegistrationClientUri is client configuration endpoint of the client (RFC 7592)
+func RegistrationClientUri(clientId string) string {
+	return _cfg.OAuthServer.Issuer + "/oauth2/v1/register/" + clientId
+}
+
+// IsValidInitialAccessToken checks initial access token of registration request, registration is disabled
+// when the token is not configured
+func IsValidInitialAccessToken(token string) bool {
+	return _cfg.OAuthServer.RegistrationToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(_cfg.OAuthServer.RegistrationToken)) == 1
+}
+
+// RegisterClient stores new client waiting for approval, client gets generated id, secret when it is not
+// public client and registration access token for management of its registration
+func RegisterClient(metadata *ClientMetadata) (*ClientInformation, error) {
+	client := &utils.Client{ClientId: uuid.New().String(), Pending: true}
+	if err := metadata.apply(client); err != nil {
+		return nil, err
+	}
+	secret := ""
+	if metadata.TokenEndpointAuthMethod != ClientAuthMethodNone {
+		secret = utils.GenerateRandomString(48)
+		hash, err := HashClientSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		client.ClientSecretHash = hash
+	}
+	if err := saveRegisteredClient(client); err != nil {
+		return nil, err
+	}
+	token := utils.GenerateRandomString(32)
+	if err := storage.Put(bucketRegistrationTokens, client.ClientId, hashValue(token), time.Time{}); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"clientId": client.ClientId,
+		"name":     client.Name,
+	}).Info("OAuth client registered, waiting for approval")
+
+	info := NewClientInformation(client)
+	info.ClientSecret = secret
+	info.RegistrationAccessToken = token
+	return info, nil
+}
+
+// AuthenticateRegistration returns dynamically registered client when registration access token is valid
+func AuthenticateRegistration(clientId string, token string) (*utils.Client, error) {
+	var hash string
+	if token == "" || storage.Get(bucketRegistrationTokens, clientId, &hash) != nil ||
+		subtle.ConstantTimeCompare([]byte(hash), []byte(hashValue(token))) != 1 {
+		log.Warn("Invalid registration access token of client: ", clientId)
+		return nil, ErrInvalidRegistrationToken()
+	}
+	client := FindRegisteredClient(clientId)
+	if client == nil {
+		return nil, ErrInvalidRegistrationToken()
+	}
+	return client, nil
+}
+
+// UpdateRegisteredClient replaces metadata of dynamically registered client, change of redirect URIs,
+// grant types, audience or branding shown to users and turning off PAR or DPoP requirement has to be approved
+// by administrator again
+func UpdateRegisteredClient(client *utils.Client, metadata *ClientMetadata) (*ClientInformation, error) {
+	updated := *client
+	if err := metadata.apply(&updated); err != nil {
+		return nil, err
+	}
+	if (metadata.TokenEndpointAuthMethod == ClientAuthMethodNone) != IsPublicClient(client) {
+		return nil, ErrInvalidClientMetadata("token_endpoint_auth_method can not be changed")
+	}
+	if !equalStrings(updated.RedirectUris, client.RedirectUris) || !equalStrings(updated.PostLogoutRedirectUris, client.PostLogoutRedirectUris) ||
+		!equalStrings(updated.GrantTypes, client.GrantTypes) || updated.Audience != client.Audience ||
+		updated.Name != client.Name || updated.LogoUri != client.LogoUri || updated.ClientUri != client.ClientUri ||
+		(client.RequirePushedAuthorizationRequests && !updated.RequirePushedAuthorizationRequests) ||
+		(client.DPoPBoundAccessTokens && !updated.DPoPBoundAccessTokens) {
+		updated.Pending = true
+	}
+	if err := saveRegisteredClient(&updated); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"clientId": updated.ClientId,
+		"pending":  updated.Pending,
+	}).Info("OAuth client registration updated")
+	return NewClientInformation(&updated), nil
+}
+
+// ApproveClient allows client waiting for approval to be used
+func ApproveClient(clientId string) error {
+	client := FindRegisteredClient(clientId)
+	if client == nil {
+		return ErrClientNotFound
+	}
+	if IsStaticClient(clientId) {
+		return ErrStaticClient
+	}
+	client.Pending = false
+	return storage.Put(bucketClients, client.ClientId, client, time.Time{})
+}
+
+// NewClientInformation describes registered client, secret and registration access token are not included
+func NewClientInformation(client *utils.Client) *ClientInformation {
+	authMethod := client.TokenEndpointAuthMethod
+	if IsPublicClient(client) {
+		authMethod = ClientAuthMethodNone
+	} else if authMethod == "" {
+		authMethod = ClientAuthMethodSecretBasic
+	}
+	return &ClientInformation{
+		ClientId:              client.ClientId,
+		RegistrationClientUri: RegistrationClientUri(client.ClientId),
+		ClientMetadata: ClientMetadata{
+			RedirectUris:                       client.RedirectUris,
+			TokenEndpointAuthMethod:            authMethod,
+			GrantTypes:                         client.GrantTypes,
+			ResponseTypes:                      []string{ResponseTypeCode},
+			ClientName:                         client.Name,
+			ClientUri:                          client.ClientUri,
+			LogoUri:                            client.LogoUri,
+			Contacts:                           client.Contacts,
+			PostLogoutRedirectUris:             client.PostLogoutRedirectUris,
+			Audience:                           client.Audience,
+			RequirePushedAuthorizationRequests: client.RequirePushedAuthorizationRequests,
+			DPoPBoundAccessTokens:              client.DPoPBoundAccessTokens,
+		},
+		Pending: client.Pending,
+	}
+}
+
+// apply validates metadata and sets it to the client, settings not available at registration are kept
+func (metadata *ClientMetadata) apply(client *utils.Client) error {
+	if metadata.TokenEndpointAuthMethod == "" {
+		metadata.TokenEndpointAuthMethod = ClientAuthMethodSecretBasic
+	}
+	if metadata.TokenEndpointAuthMethod != ClientAuthMethodSecretBasic && metadata.TokenEndpointAuthMethod != ClientAuthMethodSecretPost &&
+		metadata.TokenEndpointAuthMethod != ClientAuthMethodNone {
+		return ErrInvalidClientMetadata("unsupported token_endpoint_auth_method")
+	}
+	if len(metadata.GrantTypes) == 0 {
+		metadata.GrantTypes = []string{GrantTypeAuthorizationCode}
+	}
+	for _, v := range metadata.GrantTypes {
+		if !utils.Contains(registrationGrantTypes, v) {
+			return ErrInvalidClientMetadata("grant type " + v + " can not be registered")
+		}
+	}
+	for _, v := range metadata.ResponseTypes {
+		if v != ResponseTypeCode {
+			return ErrInvalidClientMetadata("unsupported response type " + v)
+		}
+	}
+	for _, v := range append(metadata.RedirectUris, metadata.PostLogoutRedirectUris...) {
+		if !isValidWebUri(v) {
+			return ErrInvalidRedirectUri("invalid redirect URI " + v)
+		}
+	}
+	if utils.Contains(metadata.GrantTypes, GrantTypeAuthorizationCode) && len(metadata.RedirectUris) == 0 {
+		return ErrInvalidRedirectUri("redirect_uris are required for authorization_code grant")
+	}
+	for _, v := range []string{metadata.ClientUri, metadata.LogoUri} {
+		if v != "" && !isValidWebUri(v) {
+			return ErrInvalidClientMetadata("invalid URI " + v)
+		}
+	}
+
+	client.TokenEndpointAuthMethod = metadata.TokenEndpointAuthMethod
+	client.RedirectUris = metadata.RedirectUris
+	client.GrantTypes = metadata.GrantTypes
+	client.Name = metadata.ClientName
+	client.ClientUri = metadata.ClientUri
+	client.LogoUri = metadata.LogoUri
+	client.Contacts = metadata.Contacts
+	client.PostLogoutRedirectUris = metadata.PostLogoutRedirectUris
+	client.Audience = metadata.Audience
+	client.RequirePushedAuthorizationRequests = metadata.RequirePushedAuthorizationRequests
+	client.DPoPBoundAccessTokens = metadata.DPoPBoundAccessTokens
+	return nil
+}
+
+func saveRegisteredClient(client *utils.Client) error {
+	if err := SaveClient(client); err != nil {
+		if errors.Is(err, ErrInvalidMetadata) {
+			return ErrInvalidClientMetadata(err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// isValidWebUri accepts absolute http and https URIs without fragment
+func isValidWebUri(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.Fragment == ""
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package oauthserver
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketRevokedTokens = "revoked_tokens"
+	bucketRevokedUsers  = "revoked_users"
+)
+
+// revokedToken is denylist entry keyed by jti, it is kept until the token expires
+type revokedToken struct {
+	Upn       string `json:"upn"`
+	RevokedAt int64  `json:"revoked_at"`
+}
+
+// revokedUser invalidates all tokens of the user issued before revocation
+type revokedUser struct {
+	RevokedAt int64 `json:"revoked_at"`
+}
+
+// RevokeToken adds token to denylist, revoked token is rejected by VerifyToken and introspection
+func RevokeToken(payload *Payload) error {
+	entry := &revokedToken{Upn: payload.Upn, RevokedAt: time.Now().Unix()}
+	expiryAt := time.Now().Add(maxTokenDuration())
+	if payload.ExpiryAt != nil {
+		expiryAt = payload.ExpiryAt.Time
+	}
+	return storage.Put(bucketRevokedTokens, payload.Id.String(), entry, expiryAt)
+}
+
+// RevokeUserTokens revokes all outstanding tokens and refresh tokens of the user, e.g. when employee leaves
+func RevokeUserTokens(upn string) error {
+	entry := &revokedUser{RevokedAt: time.Now().Unix()}
+	if err := storage.Put(bucketRevokedUsers, upn, entry, time.Now().Add(maxTokenDuration())); err != nil {
+		return err
+	}
+	var families []string
+	err := storage.List(bucketRefreshTokenFamilies, func(key string, data []byte) error {
+		family := &refreshTokenFamily{}
+		if err := json.Unmarshal(data, family); err != nil {
+			return err
+		}
+		if family.Upn == upn && !family.Revoked {
+			families = append(families, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, v := range families {
+		if err := RevokeRefreshTokenFamily(v); err != nil {
+			return err
+		}
+	}
+	log.WithFields(log.Fields{
+		"upn":      upn,
+		"families": len(families),
+	}).Info("Revoked all tokens of user")
+	return nil
+}
+
+// RevokeClientToken revokes refresh token or access token issued to the client (RFC 7009), tokens of other
+// clients and invalid tokens are ignored
+func RevokeClientToken(client *utils.Client, token string, tokenTypeHint string) error {
+	_, err := revoke(client, token, tokenTypeHint)
+	return err
+}
+
+// RevokeAnyToken revokes any valid token issued by the server, false is returned for unknown token
+func RevokeAnyToken(token string) (bool, error) {
+	return revoke(nil, token, "")
+}
+
+func revoke(client *utils.Client, token string, tokenTypeHint string) (bool, error) {
+	if tokenTypeHint != TokenTypeHintAccessToken {
+		if refresh, ok := findActiveRefreshToken(token); ok {
+			if client != nil && refresh.ClientId != client.ClientId {
+				log.Warn("Refresh token issued to another client: ", refresh.ClientId, " revoked by: ", client.ClientId)
+				return false, nil
+			}
+			return true, RevokeRefreshTokenFamily(refresh.FamilyId)
+		}
+	}
+	payload, err := VerifyToken(token)
+	if err != nil {
+		return false, nil
+	}
+	if client != nil && payload.ClientId != client.ClientId {
+		log.Warn("Token issued to another client: ", payload.ClientId, " revoked by: ", client.ClientId)
+		return false, nil
+	}
+	log.WithFields(log.Fields{
+		"upn": payload.Upn,
+		"jti": payload.Id.String(),
+	}).Info("Token revoked")
+	return true, RevokeToken(payload)
+}
+
+// IsRevoked checks denylist of tokens and users
+func IsRevoked(payload *Payload) bool {
+	token := &revokedToken{}
+	if err := storage.Get(bucketRevokedTokens, payload.Id.String(), token); err == nil {
+		return true
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		// denylist is not available, token can not be trusted
+		log.Error("Unable to check revoked tokens: ", err)
+		return true
+	}
+	if payload.SessionId != "" && isSessionEnded(payload.SessionId) {
+		return true
+	}
+	user := &revokedUser{}
+	if err := storage.Get(bucketRevokedUsers, payload.Upn, user); err == nil {
+		return payload.IssueAt == nil || payload.IssueAt.Unix() <= user.RevokedAt
+	}
+	return false
+}
+
+// maxTokenDuration is the longest lifetime of issued tokens, denylist entries are kept for this time
+func maxTokenDuration() time.Duration {
+	duration := time.Second * time.Duration(_cfg.OAuthServer.Duration)
+	static, registered, err := ListClients()
+	if err != nil {
+		log.Error("Unable to list clients: ", err)
+	}
+	for _, v := range _cfg.OAuthServer.StaticAudiences {
+		if d := time.Second * time.Duration(v.Duration); d > duration {
+			duration = d
+		}
+	}
+	for _, v := range append(static, registered...) {
+		if d := AccessTokenDuration(&v); d > duration {
+			duration = d
+		}
+		if d := IdTokenDuration(&v); d > duration {
+			duration = d
+		}
+	}
+	return duration
+}
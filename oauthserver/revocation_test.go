@@ -0,0 +1,92 @@
+package oauthserver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+func TestRevokeClientToken(t *testing.T) {
+	client := &utils.Client{ClientId: "app"}
+	other := &utils.Client{ClientId: "other"}
+	refreshToken := func(t *testing.T) string {
+		token, err := createRefreshToken(client, &RefreshToken{Params: model.Params{Upn: "user@example.com"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	isAccessTokenRevoked := func(t *testing.T, token string) bool {
+		_, err := VerifyToken(token)
+		if err != nil && !errors.Is(err, ErrRevokedToken) {
+			t.Fatal(err)
+		}
+		return err != nil
+	}
+	isRefreshTokenRevoked := func(t *testing.T, token string) bool {
+		_, ok := findActiveRefreshToken(token)
+		return !ok
+	}
+
+	tests := []struct {
+		name          string
+		token         func(t *testing.T) string
+		isRevoked     func(t *testing.T, token string) bool
+		client        *utils.Client
+		tokenTypeHint string
+		wantRevoked   bool
+	}{
+		{name: "access token", token: func(t *testing.T) string { return createTestToken(t, "app", testAudience) }, isRevoked: isAccessTokenRevoked, client: client, wantRevoked: true},
+		{name: "access token with hint", token: func(t *testing.T) string { return createTestToken(t, "app", testAudience) }, isRevoked: isAccessTokenRevoked, client: client, tokenTypeHint: TokenTypeHintAccessToken, wantRevoked: true},
+		{name: "access token of another client", token: func(t *testing.T) string { return createTestToken(t, "app", testAudience) }, isRevoked: isAccessTokenRevoked, client: other},
+		{name: "refresh token", token: refreshToken, isRevoked: isRefreshTokenRevoked, client: client, wantRevoked: true},
+		{name: "refresh token with hint", token: refreshToken, isRevoked: isRefreshTokenRevoked, client: client, tokenTypeHint: TokenTypeHintRefreshToken, wantRevoked: true},
+		{name: "refresh token of another client", token: refreshToken, isRevoked: isRefreshTokenRevoked, client: other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token(t)
+			if err := RevokeClientToken(tt.client, token, tt.tokenTypeHint); err != nil {
+				t.Fatal(err)
+			}
+			if revoked := tt.isRevoked(t, token); revoked != tt.wantRevoked {
+				t.Fatalf("revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+
+	t.Run("invalid token", func(t *testing.T) {
+		if err := RevokeClientToken(client, "invalid", ""); err != nil {
+			t.Fatalf("invalid token is not ignored: %v", err)
+		}
+	})
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	client := &utils.Client{ClientId: "app"}
+	params := &model.Params{Upn: "leaver@example.com", Audience: testAudience, ClientId: client.ClientId}
+	accessToken, _, err := CreateToken(params, &model.SysApiUserDetail{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := createRefreshToken(client, &RefreshToken{Params: *params})
+	if err != nil {
+		t.Fatal(err)
+	}
+	colleagueToken := createTestToken(t, client.ClientId, testAudience)
+
+	if err := RevokeUserTokens(params.Upn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyToken(accessToken); !errors.Is(err, ErrRevokedToken) {
+		t.Fatalf("access token error = %v, want %v", err, ErrRevokedToken)
+	}
+	if _, ok := findActiveRefreshToken(refreshToken); ok {
+		t.Fatal("refresh token of the user is active")
+	}
+	if _, err := VerifyToken(colleagueToken); err != nil {
+		t.Fatalf("token of another user is rejected: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package oauthserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	"github.com/shieldoo/shieldoo-mesh-oauth/verifier"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bucketEndedSessions  = "ended_sessions"
+	bucketSessionClients = "session_clients"
+)
+
+// endedSession is denylist entry keyed by session id, tokens of the session are rejected until they expire
+type endedSession struct {
+	Upn     string `json:"upn"`
+	EndedAt int64  `json:"ended_at"`
+}
+
+// sessionClients are clients which got tokens in the session, they are notified when the session ends
+type sessionClients struct {
+	ClientIds []string `json:"client_ids"`
+}
+
+// recordSessionClient remembers that client got tokens in the session, entry lives as long as tokens
+// or refresh tokens of the client can
+func recordSessionClient(sessionId string, client *utils.Client) error {
+	clients := &sessionClients{}
+	if err := storage.Get(bucketSessionClients, sessionId, clients); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if !utils.Contains(clients.ClientIds, client.ClientId) {
+		clients.ClientIds = append(clients.ClientIds, client.ClientId)
+	}
+	duration := maxTokenDuration()
+	if d := RefreshTokenDuration(client); d > duration {
+		duration = d
+	}
+	return storage.Put(bucketSessionClients, sessionId, clients, time.Now().Add(duration))
+}
+
+// VerifyIdTokenHint verifies id_token sent by client at logout, expired id_tokens are accepted
+// (OpenID Connect RP-Initiated Logout section 2), revoked ones too so logout can be repeated,
+// access and logout tokens are rejected
+func VerifyIdTokenHint(token string) (*Payload, error) {
+	payload, err := globJwtMaker.VerifyToken(token)
+	if errors.Is(err, ErrExpiredToken) {
+		// signature is verified before expiry, so expired token can be decoded
+		payload = &Payload{}
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+		}
+		if typ, _ := parsed.Header["typ"].(string); typ == verifier.LogoutTokenType || payload.Events != nil {
+			return nil, fmt.Errorf("%w: logout token can not be used as id_token_hint", ErrInvalidToken)
+		}
+		if payload.Issuer != _cfg.OAuthServer.Issuer {
+			return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidToken, payload.Issuer)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if payload.TokenUse != TokenUseId {
+		return nil, fmt.Errorf("%w: token is not id_token", ErrInvalidToken)
+	}
+	return payload, nil
+}
+
+// EndSession revokes all tokens and refresh tokens of the session and notifies clients using back-channel
+// logout, tokens issued without session are not affected
+func EndSession(payload *Payload) error {
+	if payload.SessionId == "" {
+		log.Debug("Token without session, nothing to end")
+		return nil
+	}
+	entry := &endedSession{Upn: payload.Upn, EndedAt: time.Now().Unix()}
+	if err := storage.Put(bucketEndedSessions, payload.SessionId, entry, time.Now().Add(maxTokenDuration())); err != nil {
+		return err
+	}
+	var families []string
+	err := storage.List(bucketRefreshTokenFamilies, func(key string, data []byte) error {
+		family := &refreshTokenFamily{}
+		if err := json.Unmarshal(data, family); err != nil {
+			return err
+		}
+		if family.SessionId == payload.SessionId && !family.Revoked {
+			families = append(families, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, v := range families {
+		if err := RevokeRefreshTokenFamily(v); err != nil {
+			return err
+		}
+	}
+	if err := scheduleBackchannelLogouts(payload.Upn, payload.SessionId); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"upn":      payload.Upn,
+		"sid":      payload.SessionId,
+		"families": len(families),
+	}).Info("Session ended")
+	return nil
+}
+
+// isSessionEnded checks denylist of sessions, unavailable denylist is considered as ended session
+func isSessionEnded(sessionId string) bool {
+	if err := storage.Get(bucketEndedSessions, sessionId, &endedSession{}); err == nil {
+		return true
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		log.Error("Unable to check ended sessions: ", err)
+		return true
+	}
+	return false
+}
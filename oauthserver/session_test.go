@@ -0,0 +1,70 @@
+package oauthserver
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+func TestVerifyIdTokenHint(t *testing.T) {
+	client := &utils.Client{ClientId: "app"}
+	params := &model.Params{Upn: "user@example.com", Audience: testAudience, ClientId: client.ClientId, SessionId: "sid"}
+	idToken, err := CreateIdToken(client, params, nil, "", time.Now().Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sign signs payload of expired token, modify changes its claims
+	sign := func(t *testing.T, modify func(payload *Payload)) string {
+		payload := &Payload{
+			Id:        uuid.New(),
+			Issuer:    testIssuer,
+			Subject:   params.Upn,
+			Upn:       params.Upn,
+			Aud:       client.ClientId,
+			SessionId: params.SessionId,
+			IssueAt:   jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+			ExpiryAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		}
+		modify(payload)
+		token, err := globJwtMaker.SignPayload(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "id_token", token: idToken},
+		{name: "expired id_token", token: sign(t, func(p *Payload) { p.TokenUse = TokenUseId })},
+		{name: "access token", token: createTestToken(t, client.ClientId, testAudience), wantErr: true},
+		{name: "expired access token", token: sign(t, func(p *Payload) { p.Aud = testAudience }), wantErr: true},
+		{name: "expired logout token", token: sign(t, func(p *Payload) {
+			p.TokenUse = TokenUseId
+			p.Events = map[string]interface{}{BackchannelLogoutEvent: struct{}{}}
+		}), wantErr: true},
+		{name: "expired id_token of another issuer", token: sign(t, func(p *Payload) {
+			p.TokenUse = TokenUseId
+			p.Issuer = "https://evil.example.com"
+		}), wantErr: true},
+		{name: "invalid token", token: "invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := VerifyIdTokenHint(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && payload.SessionId != params.SessionId {
+				t.Fatalf("unexpected payload %+v", payload)
+			}
+		})
+	}
+}
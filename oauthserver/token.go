@@ -0,0 +1,144 @@
+package oauthserver
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	ScopeOpenId                = "openid"
+)
+
+// TokenResponse is successful response of token endpoint (RFC 6749 section 5.1)
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// token type of token issued by token exchange (RFC 8693 section 2.2.1)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// ExchangeAuthorizationCode issues access token, refresh token when client is allowed to use refresh_token grant
+// and, for openid scope, id_token for redeemed authorization code, tokens are bound to DPoP key jkt when set
+func ExchangeAuthorizationCode(client *utils.Client, authCode *AuthorizationCode, jkt string) (*TokenResponse, error) {
+	if authCode.Request.DPoPJkt != "" && authCode.Request.DPoPJkt != jkt {
+		return nil, ErrInvalidDPoPProof("DPoP key does not match dpop_jkt of authorization request")
+	}
+	refresh := &RefreshToken{
+		Scope:       authCode.Request.Scope,
+		Params:      authCode.Params,
+		UserDetails: authCode.UserDetails,
+		AuthTime:    authCode.AuthTime,
+	}
+	return createTokenResponse(client, refresh, authCode.Request.Nonce, jkt)
+}
+
+// ExchangeRefreshToken issues new tokens for redeemed refresh token, user details are refreshed by the caller,
+// new refresh token continues the token family, token family bound to DPoP key stays bound to the key
+// it was issued with (RFC 9449 section 5)
+func ExchangeRefreshToken(client *utils.Client, refresh *RefreshToken, scope string, userDetails *model.SysApiUserDetail, jkt string) (*TokenResponse, error) {
+	if jkt == "" && IsDPoPRequired(client) {
+		return nil, ErrInvalidDPoPProof("DPoP proof is required for the client")
+	}
+	if refresh.Params.Jkt != "" && refresh.Params.Jkt != jkt {
+		return nil, ErrInvalidDPoPProof("DPoP key does not match refresh token")
+	}
+	next := *refresh
+	if err := next.narrowScope(scope); err != nil {
+		return nil, err
+	}
+	next.UserDetails = userDetails
+	return createTokenResponse(client, &next, "", jkt)
+}
+
+// ExchangeClientCredentials issues access token to confidential client acting on its own behalf, subject
+// of the token is client id and roles are given by the client, refresh token is not issued (RFC 6749 section 4.4.3)
+func ExchangeClientCredentials(client *utils.Client, jkt string) (*TokenResponse, error) {
+	if IsPublicClient(client) {
+		return nil, ErrUnauthorizedClient("public client can not use client_credentials grant")
+	}
+	params := &model.Params{
+		Upn:      client.ClientId,
+		Name:     client.Name,
+		Audience: ClientAudience(client),
+		ClientId: client.ClientId,
+		Jkt:      jkt,
+	}
+	accessToken, expiryAt, err := createAccessToken(client, params, &model.SysApiUserDetail{Roles: client.Roles})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   accessTokenType(jkt),
+		ExpiresIn:   int64(time.Until(expiryAt).Seconds()),
+	}, nil
+}
+
+func createTokenResponse(client *utils.Client, refresh *RefreshToken, nonce string, jkt string) (*TokenResponse, error) {
+	// sign in starts new session, refreshed tokens stay in the session
+	if refresh.Params.SessionId == "" {
+		refresh.Params.SessionId = utils.GenerateRandomString(16)
+	}
+	if err := recordSessionClient(refresh.Params.SessionId, client); err != nil {
+		return nil, err
+	}
+	refresh.Params.Jkt = jkt
+	accessToken, expiryAt, err := createAccessToken(client, &refresh.Params, refresh.UserDetails)
+	if err != nil {
+		return nil, err
+	}
+	response := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   accessTokenType(jkt),
+		ExpiresIn:   int64(time.Until(expiryAt).Seconds()),
+		Scope:       refresh.Scope,
+	}
+	if IsGrantTypeAllowed(client, GrantTypeRefreshToken) {
+		response.RefreshToken, err = createRefreshToken(client, refresh)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hasScope(refresh.Scope, ScopeOpenId) {
+		response.IdToken, err = CreateIdToken(client, &refresh.Params, refresh.UserDetails, nonce, refresh.AuthTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// CreateIdToken creates OpenID Connect id_token, its audience is the client
+func CreateIdToken(client *utils.Client, params *model.Params, userDetails *model.SysApiUserDetail, nonce string, authTime int64) (string, error) {
+	payload, err := NewPayload(params, IdTokenDuration(client), userDetails)
+	if err != nil {
+		return "", err
+	}
+	payload.Aud = client.ClientId
+	payload.TokenUse = TokenUseId
+	// id_token is not presented to resource servers, so it is not bound to DPoP key
+	payload.Confirmation = nil
+	payload.Nonce = nonce
+	payload.AuthTime = jwt.NewNumericDate(time.Unix(authTime, 0))
+	return globJwtMaker.SignPayload(payload)
+}
+
+func hasScope(scope string, value string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
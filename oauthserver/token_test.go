@@ -0,0 +1,61 @@
+package oauthserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+)
+
+func TestExchangeClientCredentials(t *testing.T) {
+	hash, err := HashClientSecret(testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &utils.Client{ClientId: "ci-pipeline", ClientSecretHash: hash, Name: "CI pipeline",
+		GrantTypes: []string{GrantTypeClientCredentials, GrantTypeRefreshToken}, Roles: []string{"ADMINISTRATOR"}, AccessTokenDuration: 300}
+	withAudience := &utils.Client{ClientId: "billing-sync", ClientSecretHash: hash,
+		GrantTypes: []string{GrantTypeClientCredentials}, Audience: "lidl"}
+
+	tests := []struct {
+		name         string
+		client       *utils.Client
+		wantAudience string
+		wantRoles    []string
+		wantCode     string
+	}{
+		{name: "default audience", client: service, wantAudience: testAudience, wantRoles: []string{"ADMINISTRATOR"}},
+		{name: "audience of the client", client: withAudience, wantAudience: "lidl"},
+		{name: "public client", client: &utils.Client{ClientId: "spa", GrantTypes: []string{GrantTypeClientCredentials}}, wantCode: "unauthorized_client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := ExchangeClientCredentials(tt.client, "")
+			if code := oauthErrorCode(err); code != tt.wantCode {
+				t.Fatalf("error = %v, want %s", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if response.RefreshToken != "" || response.IdToken != "" {
+				t.Fatal("refresh token or id_token issued for client credentials")
+			}
+			if response.TokenType != "Bearer" {
+				t.Fatalf("token type = %s, want Bearer", response.TokenType)
+			}
+			payload, err := VerifyToken(response.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload.Subject != tt.client.ClientId || payload.ClientId != tt.client.ClientId || payload.Aud != tt.wantAudience {
+				t.Fatalf("unexpected payload %+v", payload)
+			}
+			if !reflect.DeepEqual(payload.Roles, tt.wantRoles) {
+				t.Fatalf("roles = %v, want %v", payload.Roles, tt.wantRoles)
+			}
+			if duration := AccessTokenDuration(tt.client).Seconds(); float64(response.ExpiresIn) > duration {
+				t.Fatalf("expires_in = %d, longer than lifetime of the client %v", response.ExpiresIn, duration)
+			}
+		})
+	}
+}
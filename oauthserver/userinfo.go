@@ -0,0 +1,55 @@
+package oauthserver
+
+import (
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+)
+
+// UserInfo is response of OpenID Connect userinfo endpoint, claims of presented token are completed
+// with user details from admin backend
+type UserInfo struct {
+	Subject  string   `json:"sub"`
+	Upn      string   `json:"upn"`
+	Name     string   `json:"name,omitempty"`
+	Aud      string   `json:"aud"`
+	Provider string   `json:"provider,omitempty"`
+	Tenant   string   `json:"tenant,omitempty"`
+	Origin   string   `json:"origin,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// TokenParams returns login parameters of the token, e.g. to authorize user again against admin backend
+func (payload *Payload) TokenParams() *model.Params {
+	return &model.Params{
+		Upn:       payload.Upn,
+		Name:      payload.Name,
+		Audience:  payload.Aud,
+		Provider:  payload.Provider,
+		Tenant:    payload.Tenant,
+		ClientId:  payload.ClientId,
+		SessionId: payload.SessionId,
+	}
+}
+
+func NewUserInfo(payload *Payload, details *model.SysApiUserDetail) *UserInfo {
+	info := &UserInfo{
+		Subject:  payload.Subject,
+		Upn:      payload.Upn,
+		Name:     payload.Name,
+		Aud:      payload.Aud,
+		Provider: payload.Provider,
+		Tenant:   payload.Tenant,
+		Roles:    payload.Roles,
+	}
+	if info.Subject == "" {
+		info.Subject = payload.Upn
+	}
+	// admin backend has current details, token could be issued before they changed
+	if details != nil {
+		if details.Name != "" {
+			info.Name = details.Name
+		}
+		info.Origin = details.Origin
+		info.Roles = details.Roles
+	}
+	return info
+}
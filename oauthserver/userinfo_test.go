@@ -0,0 +1,58 @@
+package oauthserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/model"
+)
+
+func TestNewUserInfo(t *testing.T) {
+	payload := &Payload{
+		Subject:  "user@example.com",
+		Upn:      "user@example.com",
+		Name:     "Token Name",
+		Aud:      testAudience,
+		Provider: "google",
+		Roles:    []string{"USER"},
+	}
+	withoutSubject := *payload
+	withoutSubject.Subject = ""
+
+	tests := []struct {
+		name    string
+		payload *Payload
+		details *model.SysApiUserDetail
+		want    *UserInfo
+	}{
+		{
+			name:    "claims of token",
+			payload: payload,
+			want:    &UserInfo{Subject: "user@example.com", Upn: "user@example.com", Name: "Token Name", Aud: testAudience, Provider: "google", Roles: []string{"USER"}},
+		},
+		{
+			name:    "current user details",
+			payload: payload,
+			details: &model.SysApiUserDetail{Name: "Current Name", Origin: "invited", Roles: []string{"ADMINISTRATOR"}},
+			want:    &UserInfo{Subject: "user@example.com", Upn: "user@example.com", Name: "Current Name", Aud: testAudience, Provider: "google", Origin: "invited", Roles: []string{"ADMINISTRATOR"}},
+		},
+		{
+			name:    "user details without name",
+			payload: payload,
+			details: &model.SysApiUserDetail{Roles: []string{"USER"}},
+			want:    &UserInfo{Subject: "user@example.com", Upn: "user@example.com", Name: "Token Name", Aud: testAudience, Provider: "google", Roles: []string{"USER"}},
+		},
+		{
+			name:    "token without subject",
+			payload: &withoutSubject,
+			want:    &UserInfo{Subject: "user@example.com", Upn: "user@example.com", Name: "Token Name", Aud: testAudience, Provider: "google", Roles: []string{"USER"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewUserInfo(tt.payload, tt.details); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("NewUserInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
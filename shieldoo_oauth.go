@@ -7,7 +7,12 @@ import (
 	"github.com/shieldoo/shieldoo-mesh-oauth/app"
 	"github.com/shieldoo/shieldoo-mesh-oauth/handler"
 	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient/basicauth"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient/google"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient/microsoft"
+	"github.com/shieldoo/shieldoo-mesh-oauth/oauthclient/oidc"
 	"github.com/shieldoo/shieldoo-mesh-oauth/oauthserver"
+	"github.com/shieldoo/shieldoo-mesh-oauth/storage"
 	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
 
 	log "github.com/sirupsen/logrus"
@@ -19,16 +24,40 @@ var cfg *utils.Config
 func Init() *utils.Config {
 	log.SetLevel(log.InfoLevel)
 	cfg = utils.ReadConfig()
+	utils.LoadTemplates()
 	log.SetLevel(log.Level(cfg.Server.Loglevel))
 	logdata, _ := json.Marshal(cfg)
 	log.Debug("config-data: ", string(logdata))
+	storage.Init(cfg)
 	handler.Init(cfg)
 	adminbackend.Init(cfg)
 	oauthserver.Init(cfg)
 	oauthclient.Init(cfg)
+	registerProviders(cfg)
 	return cfg
 }
 
+// registerProviders registers enabled identity providers, new provider package has to be registered here
+func registerProviders(cfg *utils.Config) {
+	if cfg.Aad.Enabled {
+		oauthclient.Register(microsoft.New(cfg))
+	}
+	if cfg.Google.Enabled {
+		oauthclient.Register(google.New(cfg))
+	}
+	for _, c := range cfg.Oidc {
+		if c.Enabled {
+			oauthclient.Register(oidc.New(cfg, c))
+		}
+	}
+	if cfg.BasicAuth.Enabled {
+		oauthclient.Register(basicauth.New(cfg))
+	}
+	if len(oauthclient.Providers()) == 0 {
+		log.Panic("No identity provider is enabled")
+	}
+}
+
 // Starts the package
 func Run() {
 	app.Run(cfg)
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltEntry struct {
+	Data     json.RawMessage `json:"d"`
+	ExpiryAt int64           `json:"e,omitempty"`
+}
+
+func (e *boltEntry) expiryTime() time.Time {
+	if e.ExpiryAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(e.ExpiryAt, 0)
+}
+
+// BoltStore keeps entries in local database file, entries survive restart of the instance
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func newBoltEntry(value interface{}, expiryAt time.Time) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	entry := &boltEntry{Data: data}
+	if !expiryAt.IsZero() {
+		entry.ExpiryAt = expiryAt.Unix()
+	}
+	return json.Marshal(entry)
+}
+
+func (s *BoltStore) Put(bucket string, key string, value interface{}, expiryAt time.Time) error {
+	raw, err := newBoltEntry(value, expiryAt)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), raw)
+	})
+}
+
+func (s *BoltStore) Add(bucket string, key string, value interface{}, expiryAt time.Time) error {
+	raw, err := newBoltEntry(value, expiryAt)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		if _, err := s.get(tx, bucket, key); err == nil {
+			return ErrExists
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return b.Put([]byte(key), raw)
+	})
+}
+
+func (s *BoltStore) Get(bucket string, key string, value interface{}) error {
+	var entry *boltEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = s.get(tx, bucket, key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(entry.Data, value)
+}
+
+func (s *BoltStore) Take(bucket string, key string, value interface{}) error {
+	var entry *boltEntry
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if entry, err = s.get(tx, bucket, key); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(bucket)).Delete([]byte(key))
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(entry.Data, value)
+}
+
+func (s *BoltStore) Delete(bucket string, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) List(bucket string, fn func(key string, data []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		now := time.Now()
+		return b.ForEach(func(k, v []byte) error {
+			entry := &boltEntry{}
+			if err := json.Unmarshal(v, entry); err != nil {
+				return err
+			}
+			if expired(entry.expiryTime(), now) {
+				return nil
+			}
+			return fn(string(k), entry.Data)
+		})
+	})
+}
+
+func (s *BoltStore) Prune() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			var keys [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				entry := &boltEntry{}
+				if err := json.Unmarshal(v, entry); err != nil || expired(entry.expiryTime(), now) {
+					keys = append(keys, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (s *BoltStore) get(tx *bolt.Tx, bucket string, key string) (*boltEntry, error) {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil, ErrNotFound
+	}
+	raw := b.Get([]byte(key))
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	entry := &boltEntry{}
+	if err := json.Unmarshal(raw, entry); err != nil {
+		return nil, err
+	}
+	if expired(entry.expiryTime(), time.Now()) {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
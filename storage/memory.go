@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	data     []byte
+	expiryAt time.Time
+}
+
+// MemoryStore keeps entries in memory of the running instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]memoryEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]map[string]memoryEntry{}}
+}
+
+func (s *MemoryStore) Put(bucket string, key string, value interface{}, expiryAt time.Time) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		b = map[string]memoryEntry{}
+		s.buckets[bucket] = b
+	}
+	b[key] = memoryEntry{data: data, expiryAt: expiryAt}
+	return nil
+}
+
+func (s *MemoryStore) Add(bucket string, key string, value interface{}, expiryAt time.Time) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.get(bucket, key); ok {
+		return ErrExists
+	}
+	b, ok := s.buckets[bucket]
+	if !ok {
+		b = map[string]memoryEntry{}
+		s.buckets[bucket] = b
+	}
+	b[key] = memoryEntry{data: data, expiryAt: expiryAt}
+	return nil
+}
+
+func (s *MemoryStore) Get(bucket string, key string, value interface{}) error {
+	s.mu.Lock()
+	entry, ok := s.get(bucket, key)
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(entry.data, value)
+}
+
+func (s *MemoryStore) Take(bucket string, key string, value interface{}) error {
+	s.mu.Lock()
+	entry, ok := s.get(bucket, key)
+	if ok {
+		delete(s.buckets[bucket], key)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(entry.data, value)
+}
+
+func (s *MemoryStore) Delete(bucket string, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[bucket], key)
+	return nil
+}
+
+func (s *MemoryStore) List(bucket string, fn func(key string, data []byte) error) error {
+	s.mu.Lock()
+	entries := map[string][]byte{}
+	for k := range s.buckets[bucket] {
+		if entry, ok := s.get(bucket, k); ok {
+			entries[k] = entry.data
+		}
+	}
+	s.mu.Unlock()
+	for k, data := range entries {
+		if err := fn(k, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, b := range s.buckets {
+		for k, v := range b {
+			if expired(v.expiryAt, now) {
+				delete(b, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) get(bucket string, key string) (memoryEntry, bool) {
+	entry, ok := s.buckets[bucket][key]
+	if !ok || expired(entry.expiryAt, time.Now()) {
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shieldoo/shieldoo-mesh-oauth/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("already exists")
+)
+
+// Store is key-value storage with expiring entries, values are stored as JSON in named buckets,
+// entries with zero expiry time never expire
+type Store interface {
+	Put(bucket string, key string, value interface{}, expiryAt time.Time) error
+	Get(bucket string, key string, value interface{}) error
+	// Add stores the entry only when valid entry with the key does not exist, ErrExists is returned otherwise,
+	// so values can be marked as used once
+	Add(bucket string, key string, value interface{}, expiryAt time.Time) error
+	// Take returns and deletes the entry atomically, so one-time values can not be used twice
+	Take(bucket string, key string, value interface{}) error
+	Delete(bucket string, key string) error
+	// List calls fn for every valid entry of the bucket
+	List(bucket string, fn func(key string, data []byte) error) error
+	// Prune removes expired entries
+	Prune() error
+}
+
+var store Store
+
+func Init(cfg *utils.Config) {
+	if cfg.Storage.Database != "" {
+		var err error
+		store, err = NewBoltStore(cfg.Storage.Database)
+		if err != nil {
+			log.Panic("Unable to open database: ", err)
+		}
+		log.Info("Using database: ", cfg.Storage.Database)
+	} else {
+		store = NewMemoryStore()
+	}
+	go pruneLoop()
+}
+
+func pruneLoop() {
+	for range time.Tick(time.Minute) {
+		if err := store.Prune(); err != nil {
+			log.Error("Unable to prune storage: ", err)
+		}
+	}
+}
+
+func Put(bucket string, key string, value interface{}, expiryAt time.Time) error {
+	return store.Put(bucket, key, value, expiryAt)
+}
+
+func Get(bucket string, key string, value interface{}) error {
+	return store.Get(bucket, key, value)
+}
+
+func Add(bucket string, key string, value interface{}, expiryAt time.Time) error {
+	return store.Add(bucket, key, value, expiryAt)
+}
+
+func Take(bucket string, key string, value interface{}) error {
+	return store.Take(bucket, key, value)
+}
+
+func Delete(bucket string, key string) error {
+	return store.Delete(bucket, key)
+}
+
+func List(bucket string, fn func(key string, data []byte) error) error {
+	return store.List(bucket, fn)
+}
+
+func expired(expiryAt time.Time, now time.Time) bool {
+	return !expiryAt.IsZero() && now.After(expiryAt)
+}
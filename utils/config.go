@@ -13,12 +13,85 @@ type StaticAudience struct {
 	Redirect     string `yaml:"redirect" envconfig:"REDIRECT"`
 	Authorize    bool   `yaml:"authorize" envconfig:"AUTHORIZE"`
 	AuthorizeUrl string `yaml:"authorizeUrl" envconfig:"AUTHORIZEURL"`
+	// access tokens of the audience are encrypted to public key of its backend when set
+	Encryption TokenEncryption `yaml:"encryption" envconfig:"ENCRYPTION"`
+	// lifetime of access tokens of the audience in seconds, oauthserver.duration is used when not set,
+	// longer lifetime of client is capped
+	Duration int `yaml:"duration" envconfig:"DURATION"`
+	// keys signing access tokens of the audience instead of oauthserver.signing, same format as signing.keys
+	SigningKeys []SigningKey `yaml:"signing_keys" envconfig:"SIGNINGKEYS"`
+	// static claims added to access tokens of the audience
+	Claims map[string]string `yaml:"claims" envconfig:"CLAIMS"`
+	// optional claims (name, tenant, provider, roles) included in access tokens, all when empty
+	OptionalClaims []string `yaml:"optional_claims" envconfig:"OPTIONALCLAIMS"`
+}
+
+// TokenEncryption wraps signed access tokens in JWE encrypted to public key of the audience
+type TokenEncryption struct {
+	// Alg is key management algorithm, RSA-OAEP-256 (RSA key) or ECDH-ES (ECDSA P-256 key)
+	Alg           string `yaml:"alg" envconfig:"ALG"`
+	PublicKeyPath string `yaml:"public_key_path" envconfig:"PUBLICKEYPATH"`
+	JwkId         string `yaml:"jwk_id" envconfig:"JWKID"`
+	// private key of the audience, server decrypts tokens of the audience at userinfo, introspection,
+	// revocation and token exchange only when set
+	PrivateKeyPath string `yaml:"private_key_path" envconfig:"PRIVATEKEYPATH"`
+}
+
+// Client is OAuth client (relying party) allowed to use login, authorization and token endpoints,
+// clients are configured here or registered in the database
+type Client struct {
+	ClientId         string   `yaml:"client_id" json:"client_id" envconfig:"CLIENTID"`
+	ClientSecretHash string   `yaml:"client_secret_hash" json:"client_secret_hash,omitempty" envconfig:"CLIENTSECRETHASH"`
+	Name             string   `yaml:"name" json:"name,omitempty" envconfig:"NAME"`
+	ClientUri        string   `yaml:"client_uri" json:"client_uri,omitempty" envconfig:"CLIENTURI"`
+	LogoUri          string   `yaml:"logo_uri" json:"logo_uri,omitempty" envconfig:"LOGOURI"`
+	Contacts         []string `yaml:"contacts" json:"contacts,omitempty" envconfig:"CONTACTS"`
+	RedirectUris     []string `yaml:"redirect_uris" json:"redirect_uris,omitempty" envconfig:"REDIRECTURIS"`
+	GrantTypes       []string `yaml:"grant_types" json:"grant_types,omitempty" envconfig:"GRANTTYPES"`
+	Providers        []string `yaml:"providers" json:"providers,omitempty" envconfig:"PROVIDERS"`
+	Audience         string   `yaml:"audience" json:"audience,omitempty" envconfig:"AUDIENCE"`
+	// roles of tokens issued to the client itself by client_credentials grant
+	Roles []string `yaml:"roles" json:"roles,omitempty" envconfig:"ROLES"`
+	// audiences client can exchange tokens for by token exchange grant, "*" allows any audience
+	ExchangeAudiences []string `yaml:"exchange_audiences" json:"exchange_audiences,omitempty" envconfig:"EXCHANGEAUDIENCES"`
+	// URIs client can redirect user to after logout
+	PostLogoutRedirectUris []string `yaml:"post_logout_redirect_uris" json:"post_logout_redirect_uris,omitempty" envconfig:"POSTLOGOUTREDIRECTURIS"`
+	// sign user out of upstream identity provider at logout
+	UpstreamLogout bool `yaml:"upstream_logout" json:"upstream_logout,omitempty" envconfig:"UPSTREAMLOGOUT"`
+	// URI where logout tokens are posted when session of any user ends
+	BackchannelLogoutUri string `yaml:"backchannel_logout_uri" json:"backchannel_logout_uri,omitempty" envconfig:"BACKCHANNELLOGOUTURI"`
+	// login page and authorization endpoint accept only requests pushed to /oauth2/v1/par
+	RequirePushedAuthorizationRequests bool `yaml:"require_pushed_authorization_requests" json:"require_pushed_authorization_requests,omitempty" envconfig:"REQUIREPUSHEDAUTHORIZATIONREQUESTS"`
+	// token endpoint issues tokens only with DPoP proof, tokens are bound to the key of the client
+	DPoPBoundAccessTokens bool `yaml:"dpop_bound_access_tokens" json:"dpop_bound_access_tokens,omitempty" envconfig:"DPOPBOUNDACCESSTOKENS"`
+	// token endpoint authentication method registered by the client (client_secret_basic when not set)
+	TokenEndpointAuthMethod string `yaml:"token_endpoint_auth_method" json:"token_endpoint_auth_method,omitempty" envconfig:"TOKENENDPOINTAUTHMETHOD"`
+	// token lifetimes in seconds, oauthserver.duration is used when not set
+	AccessTokenDuration int `yaml:"access_token_duration" json:"access_token_duration,omitempty" envconfig:"ACCESSTOKENDURATION"`
+	IdTokenDuration     int `yaml:"id_token_duration" json:"id_token_duration,omitempty" envconfig:"IDTOKENDURATION"`
+	// sliding lifetime of refresh tokens, default 30 days
+	RefreshTokenDuration int `yaml:"refresh_token_duration" json:"refresh_token_duration,omitempty" envconfig:"REFRESHTOKENDURATION"`
+	// client registered dynamically can not be used until administrator approves it
+	Pending bool `yaml:"-" json:"pending,omitempty" ignored:"true"`
 }
 
 type Signing struct {
 	Method string `yaml:"method" envconfig:"METHOD"`
 	Rs256  Rs256  `yaml:"rs256" envconfig:"RS256"`
 	Hs256  Hs256  `yaml:"hs256" envconfig:"HS256"`
+	Es256  Es256  `yaml:"es256" envconfig:"ES256"`
+	EdDSA  EdDSA  `yaml:"eddsa" envconfig:"EDDSA"`
+	// key set for rotation of asymmetric keys, it takes precedence over single key of the method
+	Keys []SigningKey `yaml:"keys" ignored:"true"`
+}
+
+// SigningKey is key of the key set, key is used for signing since activate_at (RFC3339) until next key activates
+type SigningKey struct {
+	JwkId          string `yaml:"jwk_id"`
+	Method         string `yaml:"method"`
+	PrivateKeyPath string `yaml:"private_key_path"`
+	PublicKeyPath  string `yaml:"public_key_path"`
+	ActivateAt     string `yaml:"activate_at"`
 }
 
 type Rs256 struct {
@@ -27,16 +100,53 @@ type Rs256 struct {
 	JwkId          string `yaml:"jwk_id" envconfig:"OAUTHSERVER_SIGNING_RS256_JWKID"`
 }
 
+type Es256 struct {
+	PrivateKeyPath string `yaml:"private_key_path" envconfig:"OAUTHSERVER_SIGNING_ES256_PRIVATEKEY"`
+	PublicKeyPath  string `yaml:"public_key_path" envconfig:"OAUTHSERVER_SIGNING_ES256_PUBLICKEY"`
+	JwkId          string `yaml:"jwk_id" envconfig:"OAUTHSERVER_SIGNING_ES256_JWKID"`
+}
+
+type EdDSA struct {
+	PrivateKeyPath string `yaml:"private_key_path" envconfig:"OAUTHSERVER_SIGNING_EDDSA_PRIVATEKEY"`
+	PublicKeyPath  string `yaml:"public_key_path" envconfig:"OAUTHSERVER_SIGNING_EDDSA_PUBLICKEY"`
+	JwkId          string `yaml:"jwk_id" envconfig:"OAUTHSERVER_SIGNING_EDDSA_JWKID"`
+}
+
 type Hs256 struct {
 	Secret string `yaml:"secret" envconfig:"OAUTHSERVER_SIGNING_HS256_SECRET"`
 }
 
+// OidcProvider describes generic OpenID Connect upstream provider (Keycloak, Okta, Authentik, Zitadel, ...),
+// endpoints and signing keys are taken from issuer's discovery document
+type OidcProvider struct {
+	Enabled      bool     `yaml:"enabled" envconfig:"ENABLED"`
+	Name         string   `yaml:"name" envconfig:"NAME"`
+	DisplayName  string   `yaml:"display_name" envconfig:"DISPLAYNAME"`
+	Issuer       string   `yaml:"issuer" envconfig:"ISSUER"`
+	ClientId     string   `yaml:"clientid" envconfig:"CLIENTID"`
+	ClientSecret string   `yaml:"clientsecret" envconfig:"CLIENTSECRET"`
+	Scopes       []string `yaml:"scopes" envconfig:"SCOPES"`
+	UpnClaim     string   `yaml:"upn_claim" envconfig:"UPNCLAIM"`
+	NameClaim    string   `yaml:"name_claim" envconfig:"NAMECLAIM"`
+}
+
+// UnmarshalYAML enables configured OIDC provider unless it is explicitly disabled
+func (p *OidcProvider) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain OidcProvider
+	p.Enabled = true
+	return unmarshal((*plain)(p))
+}
+
 type Config struct {
 	Server struct {
-		Port     string `yaml:"port" envconfig:"PORT"`
-		Uri      string `yaml:"uri" envconfig:"URI"`
-		Loglevel int    `yaml:"loglevel" envconfig:"LOGLEVEL"`
+		Port       string `yaml:"port" envconfig:"PORT"`
+		Uri        string `yaml:"uri" envconfig:"URI"`
+		Loglevel   int    `yaml:"loglevel" envconfig:"LOGLEVEL"`
+		AdminToken string `yaml:"admin_token" envconfig:"ADMINTOKEN"`
 	} `yaml:"server"`
+	Storage struct {
+		Database string `yaml:"database" envconfig:"DATABASE"`
+	} `yaml:"storage"`
 	AdminBackend struct {
 		BaseUrl string `yaml:"base_url" envconfig:"BASEURL"`
 	} `yaml:"adminbackend"`
@@ -48,8 +158,18 @@ type Config struct {
 		Signing          Signing          `yaml:"signing" envconfig:"SIGNING"`
 		Issuer           string           `yaml:"issuer" envconfig:"ISSUER"`
 		RedirectDomain   string           `yaml:"redirect_domain" envconfig:"REDIRECTDOMAIN"`
+		CodeDuration     int              `yaml:"code_duration" envconfig:"CODEDURATION"`
+		Clients          []Client         `yaml:"clients" envconfig:"CLIENTS"`
+		RequireClient    bool             `yaml:"require_client" envconfig:"REQUIRECLIENT"`
+		// initial access token of dynamic client registration, registration is disabled when empty
+		RegistrationToken string `yaml:"registration_token" envconfig:"REGISTRATIONTOKEN"`
 	} `yaml:"oauthserver"`
+	OAuthClient struct {
+		StateSecret   string `yaml:"state_secret" envconfig:"STATESECRET"`
+		StateDuration int    `yaml:"state_duration" envconfig:"STATEDURATION"`
+	} `yaml:"oauthclient"`
 	Aad struct {
+		Enabled      bool     `yaml:"enabled" envconfig:"ENABLED"`
 		ClientId     string   `yaml:"clientid" envconfig:"CLIENTID"`
 		ClientSecret string   `yaml:"clientsecret" envconfig:"CLIENTSECRET"`
 		TenantId     string   `yaml:"tenantid" envconfig:"TENANTID"`
@@ -58,11 +178,13 @@ type Config struct {
 		Issuers      []string `yaml:"issuers"`
 	} `yaml:"aad"`
 	Google struct {
+		Enabled      bool     `yaml:"enabled" envconfig:"ENABLED"`
 		ClientId     string   `yaml:"clientid" envconfig:"CLIENTID"`
 		ClientSecret string   `yaml:"clientsecret" envconfig:"CLIENTSECRET"`
 		CallbackUrl  string   `yaml:"callback_url" envconfig:"CALLBACKURL"`
 		Issuers      []string `yaml:"issuers"`
 	} `yaml:"google"`
+	Oidc      []OidcProvider `yaml:"oidc" envconfig:"OIDC"`
 	BasicAuth struct {
 		Enabled bool   `yaml:"enabled" envconfig:"ENABLED"`
 		Users   string `yaml:"users" envconfig:"USERS"`
@@ -93,6 +215,10 @@ func readFile(cfg *Config) {
 		_ = f.Close()
 	}(f)
 
+	// providers available before they could be enabled or disabled stay enabled by default
+	cfg.Aad.Enabled = true
+	cfg.Google.Enabled = true
+
 	decoder := yaml.NewDecoder(f)
 	err = decoder.Decode(cfg)
 	if err != nil {
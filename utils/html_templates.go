@@ -7,7 +7,12 @@ import (
 	"github.com/shieldoo/shieldoo-mesh-oauth/model"
 )
 
-var templates = template.Must(template.ParseFiles("templates/login.html", "templates/general.html", "templates/basicauth.html"))
+var templates *template.Template
+
+// LoadTemplates parses HTML templates from templates directory of working directory
+func LoadTemplates() {
+	templates = template.Must(template.ParseFiles("templates/login.html", "templates/general.html", "templates/autologin.html", "templates/device.html"))
+}
 
 func RenderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
 	RenderTemplateWithResultCode(w, tmpl, data, http.StatusOK)
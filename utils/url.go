@@ -0,0 +1,17 @@
+package utils
+
+import "net/url"
+
+// AddQueryParams appends query parameters to given URL, existing parameters are preserved
+func AddQueryParams(rawUrl string, params map[string]string) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,59 @@
+package verifier
+
+import (
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	// LogoutTokenType is typ header of back-channel logout tokens
+	LogoutTokenType = "logout+jwt"
+)
+
+// Claims are claims of tokens issued by Shieldoo OAuth server, audience can be string or array
+type Claims struct {
+	Issuer    string           `json:"iss"`
+	Id        string           `json:"jti"`
+	Subject   string           `json:"sub,omitempty"`
+	Audience  jwt.ClaimStrings `json:"aud,omitempty"`
+	IssuedAt  *jwt.NumericDate `json:"iat,omitempty"`
+	NotBefore *jwt.NumericDate `json:"nbf,omitempty"`
+	ExpiresAt *jwt.NumericDate `json:"exp,omitempty"`
+	Upn       string           `json:"upn,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Provider  string           `json:"provider,omitempty"`
+	Tenant    string           `json:"tenant,omitempty"`
+	Roles     []string         `json:"roles,omitempty"`
+	ClientId  string           `json:"client_id,omitempty"`
+	SessionId string           `json:"sid,omitempty"`
+	// Events are set in back-channel logout tokens only
+	Events map[string]interface{} `json:"events,omitempty"`
+	// Confirmation is set in tokens bound to DPoP key of the client
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+}
+
+// Valid is no-op, claims are validated by Verifier with its issuer, audience and clock skew
+func (claims *Claims) Valid() error {
+	return nil
+}
+
+func (claims *Claims) HasRole(role string) bool {
+	return contains(claims.Roles, role)
+}
+
+// IsLogoutToken returns true for back-channel logout token, such token ends session SessionId
+// and can not be used as access token
+func (claims *Claims) IsLogoutToken() bool {
+	_, ok := claims.Events[backchannelLogoutEvent]
+	return ok
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package verifier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+const (
+	// AuthSchemeDPoP is authorization scheme of DPoP-bound access tokens (RFC 9449 section 7.1)
+	AuthSchemeDPoP = "DPoP"
+
+	proofType = "dpop+jwt"
+)
+
+var ErrInvalidProof = errors.New("DPoP proof is invalid")
+
+// ProofAlgorithms are asymmetric algorithms accepted for DPoP proofs
+var ProofAlgorithms = []string{"RS256", "PS256", "ES256", "EdDSA"}
+
+// Confirmation binds token to public key of the client (RFC 9449 section 6.1)
+type Confirmation struct {
+	// Jkt is base64url SHA-256 thumbprint of the key (RFC 7638)
+	Jkt string `json:"jkt"`
+}
+
+// Proof is verified DPoP proof (RFC 9449 section 4.2)
+type Proof struct {
+	Id       string
+	IssuedAt time.Time
+	// Jkt is thumbprint of the key which signed the proof
+	Jkt string
+}
+
+type proofClaims struct {
+	Id       string           `json:"jti"`
+	Method   string           `json:"htm"`
+	Uri      string           `json:"htu"`
+	IssuedAt *jwt.NumericDate `json:"iat"`
+	Ath      string           `json:"ath,omitempty"`
+}
+
+func (claims *proofClaims) Valid() error {
+	return nil
+}
+
+// VerifyProof verifies DPoP proof of HTTP request with method and uri, proof presented with access token
+// has to contain its hash, accessToken is empty at token endpoint. Replay of the proof is not checked.
+func VerifyProof(proof string, method string, uri string, accessToken string, maxAge time.Duration) (*Proof, error) {
+	verified := &Proof{}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, errors.New("unexpected typ header")
+		}
+		key, jkt, err := proofKey(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		verified.Jkt = jkt
+		return key, nil
+	}
+	claims := &proofClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(ProofAlgorithms))
+	if _, err := parser.ParseWithClaims(proof, claims, keyFunc); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+
+	if claims.Id == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: missing jti or iat claim", ErrInvalidProof)
+	}
+	if claims.Method != method {
+		return nil, fmt.Errorf("%w: htm does not match request", ErrInvalidProof)
+	}
+	if !matchUri(claims.Uri, uri) {
+		return nil, fmt.Errorf("%w: htu does not match request", ErrInvalidProof)
+	}
+	// proofs are short-lived, clock of the client can be slightly ahead
+	age := time.Since(claims.IssuedAt.Time)
+	if age > maxAge || age < -maxAge {
+		return nil, fmt.Errorf("%w: iat is out of acceptable window", ErrInvalidProof)
+	}
+	if accessToken != "" && claims.Ath != AccessTokenHash(accessToken) {
+		return nil, fmt.Errorf("%w: ath does not match access token", ErrInvalidProof)
+	}
+	verified.Id = claims.Id
+	verified.IssuedAt = claims.IssuedAt.Time
+	return verified, nil
+}
+
+// VerifyBoundToken verifies token presented with DPoP proof, token bound to a key by cnf claim is accepted
+// with proof signed by the key only
+func (v *Verifier) VerifyBoundToken(ctx context.Context, token string, proof string, method string, uri string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := v.verify(ctx, token, claims, verifyMode{acceptBound: true}); err != nil {
+		return nil, err
+	}
+	if claims.Confirmation == nil {
+		return claims, nil
+	}
+	if proof == "" {
+		return nil, fmt.Errorf("%w: token is bound to DPoP key", ErrInvalidProof)
+	}
+	verified, err := VerifyProof(proof, method, uri, token, v.opts.ProofMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	if verified.Jkt != claims.Confirmation.Jkt {
+		return nil, fmt.Errorf("%w: key does not match token", ErrInvalidProof)
+	}
+	if v.opts.IsProofReplayed != nil {
+		replayed, err := v.opts.IsProofReplayed(ctx, verified)
+		if err != nil || replayed {
+			return nil, fmt.Errorf("%w: proof has been used", ErrInvalidProof)
+		}
+	}
+	return claims, nil
+}
+
+// AccessTokenHash is ath claim of DPoP proof presented with the token
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// proofKey returns public key of jwk header and its thumbprint, private keys are rejected
+func proofKey(header interface{}) (interface{}, string, error) {
+	if header == nil {
+		return nil, "", errors.New("missing jwk header")
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := jwk.ParseKey(data)
+	if err != nil {
+		return nil, "", err
+	}
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return nil, "", err
+	}
+	switch raw.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, "", errors.New("jwk header is not public key")
+	}
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// matchUri compares htu claim with request URI without query and fragment (RFC 9449 section 4.3)
+func matchUri(htu string, uri string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.Path == b.Path
+}
@@ -0,0 +1,160 @@
+package verifier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+const (
+	testMethod = "GET"
+	testUri    = "https://api.example.com/orders"
+)
+
+// testJwk returns jwk header of the key and its thumbprint
+func testJwk(t *testing.T, key interface{}) (map[string]interface{}, string) {
+	t.Helper()
+	k, err := jwk.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := map[string]interface{}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatal(err)
+	}
+	thumbprint, err := k.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header, base64.RawURLEncoding.EncodeToString(thumbprint)
+}
+
+// testProofClaims are valid claims of proof of testMethod request to testUri with access token
+func testProofClaims(accessToken string) *proofClaims {
+	claims := &proofClaims{Id: "proof-jti", Method: testMethod, Uri: testUri, IssuedAt: jwt.NewNumericDate(time.Now())}
+	if accessToken != "" {
+		claims.Ath = AccessTokenHash(accessToken)
+	}
+	return claims
+}
+
+func signTestProof(t *testing.T, key *ecdsa.PrivateKey, claims *proofClaims, header map[string]interface{}, typ string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = typ
+	token.Header["jwk"] = header
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyProof(t *testing.T) {
+	key := newTestKey(t)
+	header, jkt := testJwk(t, &key.PublicKey)
+	privateHeader, _ := testJwk(t, key)
+	accessToken := "access-token"
+
+	proof := func(modify func(claims *proofClaims)) string {
+		claims := testProofClaims(accessToken)
+		if modify != nil {
+			modify(claims)
+		}
+		return signTestProof(t, key, claims, header, proofType)
+	}
+	tests := []struct {
+		name    string
+		proof   string
+		uri     string
+		wantErr bool
+	}{
+		{name: "valid", proof: proof(nil), uri: testUri},
+		{name: "query of request is ignored", proof: proof(nil), uri: testUri + "?page=2"},
+		{name: "wrong htm", proof: proof(func(c *proofClaims) { c.Method = "POST" }), uri: testUri, wantErr: true},
+		{name: "wrong htu path", proof: proof(func(c *proofClaims) { c.Uri = "https://api.example.com/users" }), uri: testUri, wantErr: true},
+		{name: "wrong htu host", proof: proof(func(c *proofClaims) { c.Uri = "https://evil.example.com/orders" }), uri: testUri, wantErr: true},
+		{name: "stale iat", proof: proof(func(c *proofClaims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * DefaultProofMaxAge)) }), uri: testUri, wantErr: true},
+		{name: "iat in future", proof: proof(func(c *proofClaims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(2 * DefaultProofMaxAge)) }), uri: testUri, wantErr: true},
+		{name: "ath mismatch", proof: proof(func(c *proofClaims) { c.Ath = AccessTokenHash("another-token") }), uri: testUri, wantErr: true},
+		{name: "missing ath", proof: proof(func(c *proofClaims) { c.Ath = "" }), uri: testUri, wantErr: true},
+		{name: "missing jti", proof: proof(func(c *proofClaims) { c.Id = "" }), uri: testUri, wantErr: true},
+		{name: "wrong typ", proof: signTestProof(t, key, testProofClaims(accessToken), header, "JWT"), uri: testUri, wantErr: true},
+		{name: "private key in jwk", proof: signTestProof(t, key, testProofClaims(accessToken), privateHeader, proofType), uri: testUri, wantErr: true},
+		{name: "signed by another key", proof: signTestProof(t, newTestKey(t), testProofClaims(accessToken), header, proofType), uri: testUri, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := VerifyProof(tt.proof, testMethod, tt.uri, accessToken, DefaultProofMaxAge)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidProof) {
+				t.Fatalf("error = %v, want %v", err, ErrInvalidProof)
+			}
+			if err == nil && verified.Jkt != jkt {
+				t.Fatalf("jkt = %s, want %s", verified.Jkt, jkt)
+			}
+		})
+	}
+}
+
+func TestVerifyBoundToken(t *testing.T) {
+	key := newTestKey(t)
+	proofKey := newTestKey(t)
+	header, jkt := testJwk(t, &proofKey.PublicKey)
+	otherHeader, _ := testJwk(t, &key.PublicKey)
+
+	bound := testClaims()
+	bound.Confirmation = &Confirmation{Jkt: jkt}
+	boundToken := signTestToken(t, key, bound, "JWT")
+	expired := testClaims()
+	expired.Confirmation = bound.Confirmation
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredToken := signTestToken(t, key, expired, "JWT")
+	logout := testClaims()
+	logout.Events = map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}}
+	logout.SessionId = "sid"
+	bearerToken := signTestToken(t, key, testClaims(), "JWT")
+
+	notReplayed := func(ctx context.Context, proof *Proof) (bool, error) { return false, nil }
+	replayed := func(ctx context.Context, proof *Proof) (bool, error) { return true, nil }
+	tests := []struct {
+		name            string
+		token           string
+		proof           string
+		isProofReplayed func(ctx context.Context, proof *Proof) (bool, error)
+		wantErr         error
+	}{
+		{name: "bearer token without proof", token: bearerToken},
+		{name: "bound token with proof", token: boundToken, proof: signTestProof(t, proofKey, testProofClaims(boundToken), header, proofType)},
+		{name: "bound token with new proof", token: boundToken, proof: signTestProof(t, proofKey, testProofClaims(boundToken), header, proofType), isProofReplayed: notReplayed},
+		{name: "bound token without proof", token: boundToken, wantErr: ErrInvalidProof},
+		{name: "proof of another key", token: boundToken, proof: signTestProof(t, key, testProofClaims(boundToken), otherHeader, proofType), wantErr: ErrInvalidProof},
+		{name: "proof of another token", token: boundToken, proof: signTestProof(t, proofKey, testProofClaims(bearerToken), header, proofType), wantErr: ErrInvalidProof},
+		{name: "replayed proof", token: boundToken, proof: signTestProof(t, proofKey, testProofClaims(boundToken), header, proofType), isProofReplayed: replayed, wantErr: ErrInvalidProof},
+		{name: "expired bound token", token: expiredToken, proof: signTestProof(t, proofKey, testProofClaims(expiredToken), header, proofType), wantErr: ErrExpiredToken},
+		{name: "logout token", token: signTestToken(t, key, logout, LogoutTokenType), wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(t, key, Options{IsProofReplayed: tt.isProofReplayed})
+			_, err := v.VerifyBoundToken(context.Background(), tt.token, tt.proof, testMethod, testUri)
+			if (tt.wantErr == nil && err != nil) || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
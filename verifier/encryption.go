@@ -0,0 +1,43 @@
+package verifier
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+)
+
+// EncryptionAlgorithms are key management algorithms of encrypted tokens, content is encrypted by
+// ContentEncryption
+var EncryptionAlgorithms = []string{string(jwa.RSA_OAEP_256), string(jwa.ECDH_ES)}
+
+// ContentEncryption is content encryption algorithm of encrypted tokens
+const ContentEncryption = string(jwa.A256GCM)
+
+// IsEncrypted checks whether token is JWE in compact serialization, signed tokens have three parts
+func IsEncrypted(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// Decrypt returns signed token nested in encrypted token, key is private key of the audience
+// (*rsa.PrivateKey for RSA-OAEP-256, *ecdsa.PrivateKey for ECDH-ES)
+func Decrypt(token string, key interface{}) (string, error) {
+	message, err := jwe.ParseString(token)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	headers := message.ProtectedHeaders()
+	alg := headers.Algorithm()
+	if !contains(EncryptionAlgorithms, string(alg)) {
+		return "", fmt.Errorf("%w: unexpected encryption algorithm %s", ErrInvalidToken, alg)
+	}
+	if string(headers.ContentEncryption()) != ContentEncryption {
+		return "", fmt.Errorf("%w: unexpected content encryption %s", ErrInvalidToken, headers.ContentEncryption())
+	}
+	signed, err := jwe.Decrypt([]byte(token), alg, key)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	return string(signed), nil
+}
@@ -0,0 +1,81 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+var ErrUnknownKey = errors.New("signing key not found")
+
+// KeySet provides public key used to verify token signed by key with given kid
+type KeySet interface {
+	LookupKey(ctx context.Context, kid string) (interface{}, error)
+}
+
+// StaticKeySet is key set of fixed keys indexed by kid, key with empty kid verifies tokens without kid header
+type StaticKeySet map[string]interface{}
+
+func (keys StaticKeySet) LookupKey(ctx context.Context, kid string) (interface{}, error) {
+	key, ok := keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// RemoteKeySet downloads keys from JWKS URI of the issuer, keys are refreshed when token is signed by unknown key
+type RemoteKeySet struct {
+	jwksUri            string
+	keys               *jwk.AutoRefresh
+	minRefreshInterval time.Duration
+	mu                 sync.Mutex
+	refreshedAt        time.Time
+}
+
+// NewRemoteKeySet creates key set of JWKS URI, e.g. https://oauth.example.com/oauth2/v1/certs
+func NewRemoteKeySet(ctx context.Context, jwksUri string, minRefreshInterval time.Duration) *RemoteKeySet {
+	keys := jwk.NewAutoRefresh(ctx)
+	keys.Configure(jwksUri, jwk.WithMinRefreshInterval(minRefreshInterval))
+	return &RemoteKeySet{jwksUri: jwksUri, keys: keys, minRefreshInterval: minRefreshInterval}
+}
+
+func (keys *RemoteKeySet) LookupKey(ctx context.Context, kid string) (interface{}, error) {
+	set, err := keys.keys.Fetch(ctx, keys.jwksUri)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := set.LookupKeyID(kid)
+	if !ok {
+		// key could be rotated, force refresh of key set but not more often than refresh interval
+		// so tokens with random kid can not flood the issuer
+		if !keys.allowRefresh() {
+			return nil, ErrUnknownKey
+		}
+		if set, err = keys.keys.Refresh(ctx, keys.jwksUri); err != nil {
+			return nil, err
+		}
+		if key, ok = set.LookupKeyID(kid); !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (keys *RemoteKeySet) allowRefresh() bool {
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	if time.Since(keys.refreshedAt) < keys.minRefreshInterval {
+		return false
+	}
+	keys.refreshedAt = time.Now()
+	return true
+}
@@ -0,0 +1,192 @@
+// Package verifier validates tokens issued by Shieldoo OAuth server, it is used by the server itself
+// and can be imported by services accepting Shieldoo tokens
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidToken = errors.New("token is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrRevokedToken = errors.New("token has been revoked")
+)
+
+// DefaultAlgorithms are asymmetric algorithms used by Shieldoo OAuth server
+var DefaultAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// DefaultProofMaxAge is accepted age of DPoP proofs
+const DefaultProofMaxAge = 60 * time.Second
+
+type Options struct {
+	// Issuer is required value of iss claim
+	Issuer string
+	// Audiences are accepted values of aud claim, audience is not checked when empty
+	Audiences []string
+	// Algorithms allowed for token signature, DefaultAlgorithms when empty
+	Algorithms []string
+	// ClockSkew tolerated when checking exp, nbf and iat claims
+	ClockSkew time.Duration
+	// Keys used to verify signature, key is selected by kid header of the token
+	Keys KeySet
+	// IsRevoked is called for otherwise valid token, token is rejected when revoked or when check fails
+	IsRevoked func(ctx context.Context, claims *Claims) (bool, error)
+	// ProofMaxAge limits age of DPoP proofs, DefaultProofMaxAge when zero
+	ProofMaxAge time.Duration
+	// IsProofReplayed is called for valid DPoP proof, proof is rejected when it was used before or when check fails
+	IsProofReplayed func(ctx context.Context, proof *Proof) (bool, error)
+	// DecryptionKey is private key of the audience, encrypted tokens (JWE) are decrypted before verification
+	// and rejected when not set
+	DecryptionKey interface{}
+	// AcceptBoundTokens accepts tokens bound to DPoP key by Verify without proof, caller checks the binding
+	AcceptBoundTokens bool
+}
+
+type Verifier struct {
+	opts Options
+}
+
+func New(opts Options) (*Verifier, error) {
+	if opts.Issuer == "" {
+		return nil, errors.New("issuer is required")
+	}
+	if opts.Keys == nil {
+		return nil, errors.New("key set is required")
+	}
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = DefaultAlgorithms
+	}
+	if opts.ProofMaxAge == 0 {
+		opts.ProofMaxAge = DefaultProofMaxAge
+	}
+	return &Verifier{opts: opts}, nil
+}
+
+// Verify verifies token and returns its claims
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := v.VerifyWithClaims(ctx, token, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// VerifyWithClaims verifies token and decodes it into custom claims, registered claims used for verification
+// are returned too, tokens bound to DPoP key are rejected unless AcceptBoundTokens is set (see VerifyBoundToken)
+func (v *Verifier) VerifyWithClaims(ctx context.Context, token string, custom jwt.Claims) (*Claims, error) {
+	return v.verify(ctx, token, custom, verifyMode{acceptBound: v.opts.AcceptBoundTokens})
+}
+
+// VerifyLogoutToken verifies back-channel logout token, logout tokens are not accepted by Verify
+func (v *Verifier) VerifyLogoutToken(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := v.verify(ctx, token, claims, verifyMode{logout: true}); err != nil {
+		return nil, err
+	}
+	if !claims.IsLogoutToken() || (claims.SessionId == "" && claims.Subject == "") {
+		return nil, fmt.Errorf("%w: missing logout event, sid or sub claim", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// verifyMode selects tokens accepted besides plain access tokens
+type verifyMode struct {
+	// acceptBound accepts tokens bound to DPoP key, binding is checked by the caller
+	acceptBound bool
+	// logout accepts only back-channel logout tokens
+	logout bool
+}
+
+func (v *Verifier) verify(ctx context.Context, token string, custom jwt.Claims, mode verifyMode) (*Claims, error) {
+	if IsEncrypted(token) {
+		if v.opts.DecryptionKey == nil {
+			return nil, fmt.Errorf("%w: encrypted token", ErrInvalidToken)
+		}
+		signed, err := Decrypt(token, v.opts.DecryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		token = signed
+	}
+	var typ string
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		typ, _ = token.Header["typ"].(string)
+		kid, _ := token.Header["kid"].(string)
+		return v.opts.Keys.LookupKey(ctx, kid)
+	}
+	parser := jwt.NewParser(jwt.WithValidMethods(v.opts.Algorithms), jwt.WithoutClaimsValidation())
+	if _, err := parser.ParseWithClaims(token, custom, keyFunc); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	claims, ok := custom.(*Claims)
+	if !ok {
+		// signature is already verified, registered claims are decoded from the same token
+		claims = &Claims{}
+		if _, _, err := parser.ParseUnverified(token, claims); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+		}
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	if claims.Confirmation != nil && !mode.acceptBound {
+		return nil, fmt.Errorf("%w: token is bound to DPoP key", ErrInvalidToken)
+	}
+	// logout tokens are signed by the same keys as access tokens
+	isLogout := typ == LogoutTokenType || claims.Events != nil
+	if isLogout != mode.logout || (mode.logout && typ != LogoutTokenType) {
+		return nil, fmt.Errorf("%w: unexpected token type", ErrInvalidToken)
+	}
+
+	if v.opts.IsRevoked != nil {
+		revoked, err := v.opts.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, fmt.Errorf("%w: revocation check failed: %s", ErrInvalidToken, err)
+		}
+		if revoked {
+			return nil, ErrRevokedToken
+		}
+	}
+	return claims, nil
+}
+
+func (v *Verifier) validate(claims *Claims) error {
+	now := time.Now()
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(claims.ExpiresAt.Add(v.opts.ClockSkew)) {
+		return ErrExpiredToken
+	}
+	if claims.NotBefore != nil && now.Add(v.opts.ClockSkew).Before(claims.NotBefore.Time) {
+		return fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+	if claims.IssuedAt != nil && now.Add(v.opts.ClockSkew).Before(claims.IssuedAt.Time) {
+		return fmt.Errorf("%w: token is issued in the future", ErrInvalidToken)
+	}
+	if claims.Issuer != v.opts.Issuer {
+		return fmt.Errorf("%w: unexpected issuer %s", ErrInvalidToken, claims.Issuer)
+	}
+	if len(claims.Audience) == 0 {
+		return fmt.Errorf("%w: missing aud claim", ErrInvalidToken)
+	}
+	if len(v.opts.Audiences) > 0 && !v.matchAudience(claims.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+func (v *Verifier) matchAudience(audience []string) bool {
+	for _, aud := range v.opts.Audiences {
+		if contains(audience, aud) {
+			return true
+		}
+	}
+	return false
+}
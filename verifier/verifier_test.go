@@ -0,0 +1,210 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+)
+
+const (
+	testIssuer   = "https://oauth.example.com"
+	testAudience = "billa"
+	testKid      = "test-key"
+)
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testClaims are valid claims of access token for testAudience
+func testClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		Issuer:    testIssuer,
+		Id:        "jti",
+		Subject:   "user@example.com",
+		Audience:  jwt.ClaimStrings{testAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		Upn:       "user@example.com",
+	}
+}
+
+func signTestToken(t *testing.T, key *ecdsa.PrivateKey, claims *Claims, typ string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = testKid
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func encryptTestToken(t *testing.T, key *ecdsa.PrivateKey, signed string) string {
+	t.Helper()
+	headers := jwe.NewHeaders()
+	if err := headers.Set(jwe.ContentTypeKey, "JWT"); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := jwe.Encrypt([]byte(signed), jwa.ECDH_ES, &key.PublicKey, jwa.A256GCM, jwa.NoCompress,
+		jwe.WithProtectedHeaders(headers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encrypted)
+}
+
+func newTestVerifier(t *testing.T, key *ecdsa.PrivateKey, opts Options) *Verifier {
+	t.Helper()
+	opts.Issuer = testIssuer
+	opts.Audiences = []string{testAudience}
+	opts.Keys = StaticKeySet{testKid: &key.PublicKey}
+	v, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	key := newTestKey(t)
+	encryptionKey := newTestKey(t)
+	v := newTestVerifier(t, key, Options{})
+	decrypting := newTestVerifier(t, key, Options{DecryptionKey: encryptionKey})
+	accepting := newTestVerifier(t, key, Options{AcceptBoundTokens: true})
+
+	valid := signTestToken(t, key, testClaims(), "JWT")
+	wrongAudience := testClaims()
+	wrongAudience.Audience = jwt.ClaimStrings{"lidl"}
+	missingAudience := testClaims()
+	missingAudience.Audience = nil
+	wrongIssuer := testClaims()
+	wrongIssuer.Issuer = "https://evil.example.com"
+	expired := testClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	missingExpiry := testClaims()
+	missingExpiry.ExpiresAt = nil
+	future := testClaims()
+	future.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	bound := testClaims()
+	bound.Confirmation = &Confirmation{Jkt: "thumbprint"}
+	logout := testClaims()
+	logout.Events = map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}}
+	logout.SessionId = "sid"
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+		wantErr  error
+	}{
+		{name: "valid", verifier: v, token: valid},
+		{name: "wrong audience", verifier: v, token: signTestToken(t, key, wrongAudience, "JWT"), wantErr: ErrInvalidToken},
+		{name: "missing audience", verifier: v, token: signTestToken(t, key, missingAudience, "JWT"), wantErr: ErrInvalidToken},
+		{name: "wrong issuer", verifier: v, token: signTestToken(t, key, wrongIssuer, "JWT"), wantErr: ErrInvalidToken},
+		{name: "expired", verifier: v, token: signTestToken(t, key, expired, "JWT"), wantErr: ErrExpiredToken},
+		{name: "missing exp", verifier: v, token: signTestToken(t, key, missingExpiry, "JWT"), wantErr: ErrInvalidToken},
+		{name: "not valid yet", verifier: v, token: signTestToken(t, key, future, "JWT"), wantErr: ErrInvalidToken},
+		{name: "signed by unknown key", verifier: v, token: signTestToken(t, newTestKey(t), testClaims(), "JWT"), wantErr: ErrInvalidToken},
+		{name: "encrypted without decryption key", verifier: v, token: encryptTestToken(t, encryptionKey, valid), wantErr: ErrInvalidToken},
+		{name: "encrypted", verifier: decrypting, token: encryptTestToken(t, encryptionKey, valid)},
+		{name: "encrypted to another key", verifier: decrypting, token: encryptTestToken(t, newTestKey(t), valid), wantErr: ErrInvalidToken},
+		{name: "bound to DPoP key", verifier: v, token: signTestToken(t, key, bound, "JWT"), wantErr: ErrInvalidToken},
+		{name: "bound to DPoP key accepted", verifier: accepting, token: signTestToken(t, key, bound, "JWT")},
+		{name: "logout token", verifier: v, token: signTestToken(t, key, logout, LogoutTokenType), wantErr: ErrInvalidToken},
+		{name: "logout events without typ", verifier: v, token: signTestToken(t, key, logout, "JWT"), wantErr: ErrInvalidToken},
+		{name: "logout typ without events", verifier: v, token: signTestToken(t, key, testClaims(), LogoutTokenType), wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if claims.Upn != "user@example.com" {
+					t.Fatalf("unexpected upn %s", claims.Upn)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRevoked(t *testing.T) {
+	key := newTestKey(t)
+	checkErr := errors.New("storage is unavailable")
+	tests := []struct {
+		name      string
+		isRevoked func(ctx context.Context, claims *Claims) (bool, error)
+		wantErr   error
+	}{
+		{name: "not revoked", isRevoked: func(ctx context.Context, claims *Claims) (bool, error) { return false, nil }},
+		{name: "revoked", isRevoked: func(ctx context.Context, claims *Claims) (bool, error) { return true, nil }, wantErr: ErrRevokedToken},
+		{name: "check failed", isRevoked: func(ctx context.Context, claims *Claims) (bool, error) { return false, checkErr }, wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(t, key, Options{IsRevoked: tt.isRevoked})
+			_, err := v.Verify(context.Background(), signTestToken(t, key, testClaims(), "JWT"))
+			if (tt.wantErr == nil && err != nil) || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyLogoutToken(t *testing.T) {
+	key := newTestKey(t)
+	v := newTestVerifier(t, key, Options{})
+
+	logout := testClaims()
+	logout.Events = map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}}
+	logout.SessionId = "sid"
+	otherEvent := testClaims()
+	otherEvent.Events = map[string]interface{}{"http://example.com/event": map[string]interface{}{}}
+	otherEvent.SessionId = "sid"
+	withoutSession := testClaims()
+	withoutSession.Events = logout.Events
+	withoutSession.Subject = ""
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "logout token", token: signTestToken(t, key, logout, LogoutTokenType)},
+		{name: "access token", token: signTestToken(t, key, testClaims(), "JWT"), wantErr: true},
+		{name: "logout events without typ", token: signTestToken(t, key, logout, "JWT"), wantErr: true},
+		{name: "other event", token: signTestToken(t, key, otherEvent, LogoutTokenType), wantErr: true},
+		{name: "missing sid and sub", token: signTestToken(t, key, withoutSession, LogoutTokenType), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.VerifyLogoutToken(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}